@@ -0,0 +1,190 @@
+package graphblast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// alertTimeout is how long an alert command or webhook may take before it's
+// given up on.
+const alertTimeout = 10 * time.Second
+
+// alertQueue is the number of alert events that may wait to be delivered
+// before more are dropped.
+const alertQueue = 100
+
+// An AlertEvent records an alert starting ("firing") or ending ("resolved")
+// for a series of a graph.
+type AlertEvent struct {
+	Graph     string // the name of the graph
+	Series    string // the name of the series, or "" for the unnamed one
+	State     string // "firing" or "resolved"
+	Value     Countable
+	Threshold float64 // the threshold crossed
+	Time      time.Time
+}
+
+// alertState tracks the run of values of a series crossing a threshold.
+type alertState struct {
+	count     int       // the number of consecutive values crossing it
+	since     time.Time // the time of the first of them
+	threshold float64
+	firing    bool
+}
+
+// Alert is a rule that fires when the values of a series stay above or below
+// a threshold for a number of consecutive values, and for at least a period
+// of time, and resolves once a value no longer crosses the threshold. Graphs
+// that embed an Alert evaluate it as values are added; the state changes are
+// collected by NotifyChanges, which broadcasts them and delivers them to the
+// configured command or webhook. The command and webhook can only be set from
+// the command line, never from the parameters of a graph's URL.
+type Alert struct {
+	AlertAbove  float64       `json:"-"` // fire when values are above this
+	AlertBelow  float64       `json:"-"` // fire when values are below this
+	AlertPoints int           `json:"-"` // the number of values to wait for
+	AlertFor    time.Duration `json:"-"` // the time to wait for
+
+	// A shell command to run, and a URL to POST events to, if set.
+	AlertCommand string `json:"-" bind:"-"`
+	AlertWebhook string `json:"-" bind:"-"`
+
+	states     map[string]*alertState
+	mu         sync.Mutex   // guards pending
+	pending    []AlertEvent // events not yet collected by Alerts
+	start      sync.Once    // starts the goroutine delivering events
+	deliveries chan AlertEvent
+}
+
+// NewAlert returns an alert with no thresholds set, which never fires.
+func NewAlert() *Alert {
+	return &Alert{
+		AlertAbove:  math.NaN(),
+		AlertBelow:  math.NaN(),
+		AlertPoints: 1,
+		states:      make(map[string]*alertState)}
+}
+
+// crossed returns the threshold crossed by val, or false if none is.
+func (a *Alert) crossed(val Countable) (float64, bool) {
+	if float64(val) > a.AlertAbove {
+		return a.AlertAbove, true
+	} else if float64(val) < a.AlertBelow {
+		return a.AlertBelow, true
+	}
+	return 0, false
+}
+
+// observe evaluates the rule for a value of the named series added at a time.
+func (a *Alert) observe(series string, when time.Time, val Countable) {
+	threshold, crossed := a.crossed(val)
+	state := a.states[series]
+	if state != nil && (!crossed || threshold != state.threshold) {
+		if state.firing {
+			a.record(AlertEvent{"", series, "resolved", val, state.threshold, when})
+		}
+		delete(a.states, series)
+		state = nil
+	}
+	if !crossed {
+		return
+	}
+
+	if state == nil {
+		state = &alertState{since: when, threshold: threshold}
+		a.states[series] = state
+	}
+	state.count += 1
+	if !state.firing && state.count >= a.AlertPoints && when.Sub(state.since) >= a.AlertFor {
+		state.firing = true
+		a.record(AlertEvent{"", series, "firing", val, threshold, when})
+	}
+}
+
+// record adds an event to those returned by Alerts.
+func (a *Alert) record(event AlertEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, event)
+}
+
+// Alerts returns the alert events since the last call.
+func (a *Alert) Alerts() []AlertEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	events := a.pending
+	a.pending = nil
+	return events
+}
+
+// Deliver queues an event to be delivered to the alert command and webhook,
+// if either is set. Events are delivered one at a time, in the order they're
+// queued, by a goroutine belonging to the alert; if too many are waiting,
+// the event is dropped.
+func (a *Alert) Deliver(event AlertEvent) {
+	if a.AlertCommand == "" && a.AlertWebhook == "" {
+		return
+	}
+	a.start.Do(func() {
+		a.deliveries = make(chan AlertEvent, alertQueue)
+		go func() {
+			for event := range a.deliveries {
+				a.deliver(event)
+			}
+		}()
+	})
+	select {
+	case a.deliveries <- event:
+	default:
+		Log("dropping alert, too many are waiting: %v", event)
+	}
+}
+
+// deliver runs the alert command (if set) with the event as JSON on its
+// standard input and in its environment, and POSTs the event as JSON to the
+// webhook (if set), giving up on either after alertTimeout. Failures are
+// logged.
+func (a *Alert) deliver(event AlertEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		Log("couldn't marshal alert: %v", err)
+		return
+	}
+
+	if a.AlertCommand != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", a.AlertCommand)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Env = append(os.Environ(),
+			"GRAPHBLAST_GRAPH="+event.Graph,
+			"GRAPHBLAST_SERIES="+event.Series,
+			"GRAPHBLAST_STATE="+event.State,
+			fmt.Sprintf("GRAPHBLAST_VALUE=%v", event.Value),
+			fmt.Sprintf("GRAPHBLAST_THRESHOLD=%v", event.Threshold))
+		if err := cmd.Run(); err != nil {
+			Log("alert command failed: %v", err)
+		}
+	}
+
+	if a.AlertWebhook != "" {
+		client := &http.Client{Timeout: alertTimeout}
+		resp, err := client.Post(a.AlertWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			Log("alert webhook failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			Log("alert webhook failed: %v", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertObserve(t *testing.T) {
+	a := NewAlert()
+	a.AlertAbove = 10
+	a.AlertPoints = 2
+	start := time.Unix(1400000000, 0)
+
+	a.observe("", start, 20)
+	if len(a.Alerts()) != 0 {
+		t.Error("observe fired before enough values crossed the threshold")
+	}
+	a.observe("", start.Add(time.Second), 5)
+	a.observe("", start.Add(2*time.Second), 20)
+	if len(a.Alerts()) != 0 {
+		t.Error("observe fired for values that weren't consecutive")
+	}
+
+	a.observe("", start.Add(3*time.Second), 30)
+	a.observe("", start.Add(4*time.Second), 40)
+	events := a.Alerts()
+	if len(events) != 1 || events[0].State != "firing" || events[0].Value != 30 {
+		t.Errorf("observe didn't fire once (%v)", events)
+	}
+	if events[0].Threshold != 10 {
+		t.Errorf("observe fired for the wrong threshold (%v)", events[0])
+	}
+
+	a.observe("other", start.Add(5*time.Second), 1)
+	a.observe("", start.Add(5*time.Second), 1)
+	events = a.Alerts()
+	if len(events) != 1 || events[0].State != "resolved" || events[0].Series != "" {
+		t.Errorf("observe didn't resolve the alert (%v)", events)
+	}
+}
+
+func TestAlertObserveFor(t *testing.T) {
+	a := NewAlert()
+	a.AlertBelow = 0
+	a.AlertFor = time.Minute
+	start := time.Unix(1400000000, 0)
+
+	a.observe("a", start, -1)
+	a.observe("a", start.Add(30*time.Second), -1)
+	if len(a.Alerts()) != 0 {
+		t.Error("observe fired before the values crossed for long enough")
+	}
+	a.observe("a", start.Add(time.Minute), -1)
+	events := a.Alerts()
+	if len(events) != 1 || events[0].Series != "a" || events[0].Threshold != 0 {
+		t.Errorf("observe didn't fire (%v)", events)
+	}
+}
+
+func TestAlertUnset(t *testing.T) {
+	a := NewAlert()
+	a.observe("", time.Now(), 1e9)
+	a.observe("", time.Now(), -1e9)
+	if len(a.Alerts()) != 0 || len(a.states) != 0 {
+		t.Error("observe fired with no thresholds set")
+	}
+}
+
+func TestAlertDeliver(t *testing.T) {
+	received := make(chan AlertEvent, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var event AlertEvent
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer server.Close()
+
+	a := NewAlert()
+	a.AlertWebhook = server.URL
+	a.Deliver(AlertEvent{Graph: "g", State: "firing", Value: 3})
+	a.Deliver(AlertEvent{Graph: "g", State: "resolved", Value: 0})
+	for _, state := range []string{"firing", "resolved"} {
+		select {
+		case event := <-received:
+			if event.Graph != "g" || event.State != state {
+				t.Errorf("Deliver posted the wrong event (%v)", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Deliver didn't post to the webhook")
+		}
+	}
+}
+
+func TestTimeSeriesAlert(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.AlertAbove = 1
+	ts.Read(strings.NewReader("0\n2\n"))
+	events := ts.Alerts()
+	if len(events) != 1 || events[0].Value != 2 {
+		t.Errorf("TimeSeries didn't evaluate its alert (%v)", events)
+	}
+
+	data, err := json.Marshal(ts)
+	if err != nil || strings.Contains(string(data), "Alert") {
+		t.Errorf("TimeSeries marshaled its alert (%s, %v)", data, err)
+	}
+}
+
+func TestNotifyChangesAlerts(t *testing.T) {
+	g := NewGauge()
+	g.AlertAbove = 1
+	g.Add(time.Now(), 2, nil)
+
+	graphs := &Graphs{map[string]Graph{"g": g}, make(map[string]int)}
+	subs := &recordingSubscribers{}
+	NotifyChanges()(graphs, subs)
+
+	alerts := 0
+	for _, message := range *subs {
+		if message.Envelope() == "__alert" {
+			alerts += 1
+			contents, _ := message.Contents()
+			if !strings.Contains(string(contents), `"Graph":"g"`) {
+				t.Errorf("NotifyChanges sent an alert without the graph (%s)", contents)
+			}
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("NotifyChanges sent %v alerts", alerts)
+	}
+}
+
+func TestParseGraphURLAlertDelivery(t *testing.T) {
+	pattern := regexp.MustCompile("^/graph/(?P<type>\\w+)/(?P<name>\\w+)$")
+	u, _ := url.Parse("/graph/timeseries/test?alertabove=0" +
+		"&alertcommand=touch+/tmp/x&alertwebhook=http://localhost/")
+	_, graph := ParseGraphURL(u, pattern)
+	ts, ok := graph.(*TimeSeries)
+	if !ok || ts.AlertAbove != 0 {
+		t.Fatalf("ParseGraphURL didn't bind the alert (%v)", graph)
+	}
+	if ts.AlertCommand != "" || ts.AlertWebhook != "" {
+		t.Errorf("ParseGraphURL bound the alert delivery (%q, %q)",
+			ts.AlertCommand, ts.AlertWebhook)
+	}
+}
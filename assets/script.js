@@ -48,7 +48,7 @@
           return setter({
             x: 0,
             y: 1,
-            height: Math.max(1, dx - 1),
+            height: function (d) { return Math.max(1, dx(d) - 1); },
             width: function (d) { return y(d.y); }
           });
         },
@@ -58,13 +58,28 @@
               var len = this.getComputedTextLength();
               return y(d.y) > len + 30 ? y(d.y) - 6 - len : y(d.y) + 6;
             },
-            y: dx * 0.5,
+            y: function (d) { return dx(d) * 0.5; },
             'class': function (d) {
               var len = this.getComputedTextLength();
               return y(d.y) > len + 30 ? 'inside' : 'outside';
             },
             'dominant-baseline': 'middle'
           });
+        },
+        marker: function (x) {
+          return setter({
+            x1: 0,
+            x2: barLength,
+            y1: function (d) { return x(d.value); },
+            y2: function (d) { return x(d.value); }
+          });
+        },
+        markerText: function (x) {
+          return setter({
+            x: barLength + 6,
+            y: function (d) { return x(d.value); },
+            'dominant-baseline': 'middle'
+          });
         }
       };
     },
@@ -92,12 +107,12 @@
             x: 1,
             y: 0,
             height: function (d) { return barLength - y(d.y); },
-            width: Math.max(1, dx - 1)
+            width: function (d) { return Math.max(1, dx(d) - 1); }
           });
         },
         text: function (x, y, dx) {
           return setter({
-            x: dx * 0.5,
+            x: function (d) { return dx(d) * 0.5; },
             y: function (d) {
               return y(d.y) > barLength - 30 ? -6 : 18;
             },
@@ -106,6 +121,21 @@
             },
             'text-anchor': 'middle'
           });
+        },
+        marker: function (x) {
+          return setter({
+            x1: function (d) { return x(d.value); },
+            x2: function (d) { return x(d.value); },
+            y1: 0,
+            y2: barLength
+          });
+        },
+        markerText: function (x) {
+          return setter({
+            x: function (d) { return x(d.value); },
+            y: -6,
+            'text-anchor': 'middle'
+          });
         }
       };
     }
@@ -118,6 +148,56 @@
     return Orientation[orientation](data, axisLength, barLength);
   };
 
+  // The units of time and bytes that values may be in (as understood by
+  // ParseUnit), with their sizes in seconds or bytes.
+  var Units = {
+    ns: ['time', 1e-9], us: ['time', 1e-6], '\u00b5s': ['time', 1e-6],
+    '\u03bcs': ['time', 1e-6],
+    ms: ['time', 1e-3], s: ['time', 1], m: ['time', 60], h: ['time', 3600],
+    B: ['bytes', 1], kB: ['bytes', 1e3], KB: ['bytes', 1e3],
+    MB: ['bytes', 1e6], GB: ['bytes', 1e9], TB: ['bytes', 1e12],
+    PB: ['bytes', 1e15], KiB: ['bytes', 1024],
+    MiB: ['bytes', Math.pow(2, 20)], GiB: ['bytes', Math.pow(2, 30)],
+    TiB: ['bytes', Math.pow(2, 40)], PiB: ['bytes', Math.pow(2, 50)]
+  };
+
+  // The units in which values of time and bytes are displayed, largest
+  // first.
+  var displayUnits = {
+    time: [['h', 3600], ['min', 60], ['s', 1], ['ms', 1e-3],
+           ['\u00b5s', 1e-6], ['ns', 1e-9]],
+    bytes: [['PB', 1e15], ['TB', 1e12], ['GB', 1e9], ['MB', 1e6],
+            ['kB', 1e3], ['B', 1]]
+  };
+
+  // Returns a function formatting values in a unit, such as "1.2 s" or
+  // "340 MB" for values in milliseconds or bytes, or null if there's no unit.
+  var unitFormat = function (unit) {
+    if (!unit) {
+      return null;
+    }
+    var known = Units[unit];
+    if (!known) {
+      var si = d3.format('.3s');
+      return function (v) { return si(v) + ' ' + unit; };
+    }
+    var sizes = displayUnits[known[0]];
+    return function (v) {
+      var base = v * known[1];
+      if (base === 0) {
+        return '0';
+      }
+      var size = sizes[sizes.length - 1];
+      for (var i = 0; i < sizes.length; i++) {
+        if (Math.abs(base) >= sizes[i][1]) {
+          size = sizes[i];
+          break;
+        }
+      }
+      return +(base / size[1]).toPrecision(3) + ' ' + size[0];
+    };
+  };
+
   var parseColors = function (colors) {
     var parts = colors ? colors.split(',') : [];
     return {
@@ -133,13 +213,16 @@
       if (colors.bg && colors.fg) {
         styles.push('body { background-color: ' + colors.bg + '}');
         styles.push('.axis path, .axis line { stroke: ' + colors.fg + '}');
+        styles.push('.marker line, line.trend { stroke: ' + colors.fg + '}');
         styles.push('text, text.outside { fill: ' + colors.fg + '}');
         styles.push('text.inside { fill: ' + colors.bg + '}');
-        styles.push('pre.lines { color: ' + colors.fg + '}');
+        styles.push('pre.lines, table.rows { color: ' + colors.fg + '}');
+        styles.push('table.rows th { border-color: ' + colors.fg + '}');
       }
       if (colors.bar) {
-        styles.push('.dot, .bar { fill: ' + colors.bar + '}');
+        styles.push('.dot, .bar, .cell { fill: ' + colors.bar + '}');
         styles.push('path.line { stroke: ' + colors.bar + '}');
+        styles.push('path.band { fill: ' + colors.bar + '}');
       }
       return styles.join('\n');
     },
@@ -176,18 +259,27 @@
 
     var orient = orientation(opts, data);
 
-    var x = d3.scale.linear()
-      .domain([d3.min(data, function (d) { return d.x; }),
-               d3.max(data, function (d) { return d.x; }) + opts.Bucket])
+    // Logarithmic buckets get a logarithmic axis, unless there are buckets
+    // that a logarithmic scale can't show.
+    var min = d3.min(data, function (d) { return d.x; });
+    var x = opts.LogBase > 1 && min > 0 ? d3.scale.log() : d3.scale.linear();
+    x.domain([min, d3.max(data, function (d) { return d.x1; })])
       .range(orient.range.x);
 
     var y = d3.scale.linear()
       .domain([0, d3.max(data, function (d) { return d.y; })])
       .range(orient.range.y);
 
-    var dx = (x(1) - x(0)) * opts.Bucket;
+    var dx = function (d) { return x(d.x1) - x(d.x); };
+
+    var axis = d3.svg.axis().scale(x).orient(orient.axis.orient)
+      .tickFormat(unitFormat(opts.Unit));
 
-    var axis = d3.svg.axis().scale(x).orient(orient.axis.orient);
+    // Categories are labeled by name, in the middle of their bars.
+    if (data[0].name !== undefined) {
+      axis.tickValues(data.map(function (d) { return d.x + 0.5; }))
+        .tickFormat(function (v) { return data[Math.floor(v)].name; });
+    }
 
     var svg = d3.select('body').append('svg')
       .attr('width', orient.svg.width)
@@ -217,6 +309,17 @@
     orient.text(x, y, dx)(
       bar.append('text').text(function (d) { return d.y; }));
 
+    var estimates = d3.entries(opts.Estimates || {});
+    var marker = svg.selectAll('.marker').data(estimates)
+      .enter()
+      .append('g')
+      .attr('class', 'marker');
+
+    orient.marker(x)(
+      marker.append('line'));
+    orient.markerText(x)(
+      marker.append('text').text(function (d) { return d.key; }));
+
     svg.append('g')
       .attr('class', 'axis')
       .attr('transform', orient.axis.transform)
@@ -225,14 +328,57 @@
 
   var pushHistogram = function (data) {
     var hist = d3.map(data.Values).entries().map(function (i) {
-      return {x: parseFloat(i.key), y: i.value};
+      var bounds = data.Bounds[i.key];
+      return {x: bounds[0], x1: bounds[1], y: i.value};
     });
-    hist.sort(d3.ascending);
+    hist.sort(function (a, b) { return d3.ascending(a.x, b.x); });
     d3.select('svg').remove();
     histogram(hist, data);
   };
 
-  var timeSeries = function (data, opts) {
+  // Categories are drawn as a histogram with a bar for each value, from most
+  // to least frequent, followed by a bar for the rest.
+  var pushCategories = function (data) {
+    var counts = d3.entries(data.Values);
+    counts.sort(function (a, b) {
+      return d3.descending(a.value, b.value) || d3.ascending(a.key, b.key);
+    });
+    if (data.Other > 0) {
+      counts.push({key: 'other', value: data.Other});
+    }
+    var bars = counts.map(function (c, i) {
+      return {x: i, x1: i + 1, y: c.value, name: c.key};
+    });
+    d3.select('svg').remove();
+    histogram(bars, data);
+  };
+
+  // Draws a legend in the top right corner of a graph, with a swatch of color
+  // next to each name.
+  var legend = function (svg, names, color, width) {
+    var entry = svg.selectAll('.legend').data(names)
+      .enter()
+      .append('g')
+      .attr('class', 'legend')
+      .attr('transform', function (d, i) {
+        return _translate(width - 12, i * 18);
+      });
+
+    entry.append('rect')
+      .attr('width', 12)
+      .attr('height', 12)
+      .style('fill', color);
+
+    entry.append('text')
+      .text(function (d) { return d; })
+      .attr('x', -6)
+      .attr('y', 6)
+      .attr('text-anchor', 'end')
+      .attr('dominant-baseline', 'middle');
+  };
+
+  var timeSeries = function (lines, opts) {
+    var data = d3.merge(lines.map(function (l) { return l.points; }));
     if (data.length <= 1) {
       // TODO Show something/anything here instead of a blank screen
       return;
@@ -248,14 +394,20 @@
       .range([0, width]);
 
     var y = d3.scale.linear()
-      .domain(d3.extent(data, function (d) { return d.y; }))
+      .domain([d3.min(data, function (d) { return d.min; }),
+               d3.max(data, function (d) { return d.max; })])
       .range([height, 0]);
 
     var xAxis = d3.svg.axis().scale(x).orient('bottom');
-    var yAxis = d3.svg.axis().scale(y).orient('left');
+    var yAxis = d3.svg.axis().scale(y).orient('left')
+      .tickFormat(unitFormat(opts.Unit));
     var line = d3.svg.line()
       .x(function (d) { return x(d.x); })
       .y(function (d) { return y(d.y); });
+    var band = d3.svg.area()
+      .x(function (d) { return x(d.x); })
+      .y0(function (d) { return y(d.min); })
+      .y1(function (d) { return y(d.max); });
 
     var svg = d3.select('body').append('svg')
       .attr('width', width + 65)
@@ -273,10 +425,39 @@
       .attr('font-size', '1.1em')
       .attr('font-weight', 'bold');
 
-    svg.append('path')
-      .datum(data)
-      .attr('class', 'line')
-      .attr('d', line);
+    var color = d3.scale.category10();
+    lines.forEach(function (l) {
+      // Rolled up values are drawn with a band from their min to max.
+      if (l.rolledUp) {
+        var area = svg.append('path')
+          .datum(l.points)
+          .attr('class', 'band')
+          .attr('d', band);
+        if (l.name) {
+          area.style('fill', color(l.name));
+        }
+      }
+      // Smoothed values are drawn over faded raw values.
+      var paths = [svg.append('path')
+        .datum(l.points)
+        .attr('class', 'line')
+        .classed('raw', l.smoothed.length > 0)
+        .attr('d', line)];
+      if (l.smoothed.length > 0) {
+        paths.push(svg.append('path')
+          .datum(l.smoothed)
+          .attr('class', 'line')
+          .attr('d', line));
+      }
+      if (l.name) {
+        paths.forEach(function (p) { p.style('stroke', color(l.name)); });
+      }
+    });
+
+    var names = lines.map(function (l) { return l.name; }).filter(Boolean);
+    if (names.length > 0) {
+      legend(svg, names, color, width);
+    }
 
     svg.append('g')
       .attr('class', 'y axis')
@@ -288,17 +469,216 @@
       .call(xAxis);
   };
 
+  // Returns the points of a series, sorted by time, from either its raw values
+  // or its rollups (if it has been rolled up).
+  var toPoints = function (series) {
+    var points = d3.entries(series.Values).map(function (i) {
+      return {x: new Date(i.key), y: i.value, min: i.value, max: i.value};
+    });
+    if (series.Resolution) {
+      points = d3.entries(series.Rollups).map(function (i) {
+        var r = i.value;
+        return {x: new Date(i.key), y: r.Avg, min: r.Min, max: r.Max};
+      });
+    }
+    return points.sort(function (a, b) {
+      return d3.ascending(a.x, b.x);
+    });
+  };
+
   var pushTimeSeries = function (data) {
-    var ts = d3.map(data.Values).entries().sort(function (a, b) {
-      return d3.ascending(a.key, b.key);
-    }).map(function (i) {
-      return {x: new Date(i.key), y: i.value};
+    var toLine = function (name, series) {
+      var smoothed = d3.entries(series.Resolution ? {} : series.Smoothed);
+      return {
+        name: name,
+        points: toPoints(series),
+        smoothed: smoothed.map(function (i) {
+          return {x: new Date(i.key), y: i.value};
+        }).sort(function (a, b) { return d3.ascending(a.x, b.x); }),
+        rolledUp: Boolean(series.Resolution)
+      };
+    };
+    var lines = [toLine('', data)];
+    d3.keys(data.Series || {}).sort().forEach(function (name) {
+      lines.push(toLine(name, data.Series[name]));
     });
     d3.select('svg').remove();
-    timeSeries(ts, data);
+    timeSeries(lines, data);
+  };
+
+  // Draws a cell for each bucket of each column of a heatmap, more opaque the
+  // more values it counted.
+  var heatmap = function (data, opts) {
+    if (data.length === 0) {
+      // TODO Show something/anything here instead of a blank screen
+      return;
+    }
+
+    applyStyle(opts);
+
+    var width = opts.Width;
+    var height = opts.Height;
+
+    var x = d3.time.scale()
+      .domain([d3.min(data, function (d) { return d.x; }),
+               d3.max(data, function (d) { return d.x1; })])
+      .range([0, width]);
+
+    var y = d3.scale.linear()
+      .domain([d3.min(data, function (d) { return d.y; }),
+               d3.max(data, function (d) { return d.y1; })])
+      .range([height, 0]);
+
+    var opacity = d3.scale.linear()
+      .domain([0, d3.max(data, function (d) { return d.count; })])
+      .range([0.1, 1]);
+
+    var xAxis = d3.svg.axis().scale(x).orient('bottom');
+    var yAxis = d3.svg.axis().scale(y).orient('left')
+      .tickFormat(unitFormat(opts.Unit));
+
+    var svg = d3.select('body').append('svg')
+      .attr('width', width + 65)
+      .attr('height', height + 105)
+      .append('g')
+      .attr('transform', _translate(50, 50));
+      // TODO Use axis/svg width for translate instead of hard-coding
+
+    svg.append('g')
+      .attr('transform', _translate(width * 0.5, height + 50))
+      .append('text')
+      .text(opts.Label)
+      .attr('class', 'label')
+      .attr('text-anchor', 'middle')
+      .attr('font-size', '1.1em')
+      .attr('font-weight', 'bold');
+
+    svg.selectAll('.cell').data(data)
+      .enter().append('rect')
+        .attr('class', 'cell')
+        .attr('x', function (d) { return x(d.x); })
+        .attr('y', function (d) { return y(d.y1); })
+        .attr('width', function (d) {
+          return Math.max(1, x(d.x1) - x(d.x) - 1);
+        })
+        .attr('height', function (d) {
+          return Math.max(1, y(d.y) - y(d.y1) - 1);
+        })
+        .style('opacity', function (d) { return opacity(d.count); })
+      .append('title')
+        .text(function (d) { return d.count; });
+
+    svg.append('g')
+      .attr('class', 'y axis')
+      .call(yAxis);
+
+    svg.append('g')
+      .attr('class', 'x axis')
+      .attr('transform', _translate(0, height))
+      .call(xAxis);
+  };
+
+  var pushHeatmap = function (data) {
+    var interval = data.Interval / 1e6; // from nanoseconds to milliseconds
+    var cells = [];
+    d3.entries(data.Values).forEach(function (column) {
+      var start = new Date(column.key);
+      var end = new Date(start.getTime() + interval);
+      d3.entries(column.value).forEach(function (cell) {
+        var bounds = data.Bounds[cell.key];
+        cells.push({
+          x: start,
+          x1: end,
+          y: bounds[0],
+          y1: bounds[1],
+          count: cell.value
+        });
+      });
+    });
+    d3.select('svg').remove();
+    heatmap(cells, data);
+  };
+
+  // Draws the latest value of a gauge in large type, colored by its level,
+  // over a sparkline of the values before it.
+  var gauge = function (data, opts) {
+    applyStyle(opts);
+
+    var width = opts.Width;
+    var height = opts.Height;
+
+    var x = d3.time.scale()
+      .domain(d3.extent(data, function (d) { return d.x; }))
+      .range([0, width]);
+
+    // Thresholds that are set (not null) are drawn across the trail.
+    var thresholds = [
+      {level: 'warn', value: opts.Warn},
+      {level: 'critical', value: opts.Critical}
+    ].filter(function (t) { return typeof t.value === 'number'; });
+
+    var y = d3.scale.linear()
+      .domain(d3.extent(data.map(function (d) { return d.y; })
+        .concat(thresholds.map(function (t) { return t.value; }))))
+      .range([height, height * 0.5]);
+
+    var line = d3.svg.line()
+      .x(function (d) { return x(d.x); })
+      .y(function (d) { return y(d.y); });
+
+    var svg = d3.select('body').append('svg')
+      .attr('width', width + 65)
+      .attr('height', height + 105)
+      .append('g')
+      .attr('class', 'gauge ' + opts.Level)
+      .attr('transform', _translate(50, 50));
+
+    if (data.length > 1) {
+      svg.append('path')
+        .datum(data)
+        .attr('class', 'line')
+        .attr('d', line);
+
+      svg.selectAll('.threshold').data(thresholds)
+        .enter().append('line')
+          .attr('class', function (t) { return 'threshold ' + t.level; })
+          .attr('x1', 0)
+          .attr('x2', width)
+          .attr('y1', function (t) { return y(t.value); })
+          .attr('y2', function (t) { return y(t.value); });
+    }
+
+    svg.append('text')
+      .text((unitFormat(opts.Unit) || function (v) {
+        return String(+v.toPrecision(6));
+      })(opts.Value))
+      .attr('class', 'value')
+      .attr('x', width * 0.5)
+      .attr('y', height * 0.5)
+      .attr('text-anchor', 'middle')
+      .attr('font-size', height * 0.3 + 'px');
+
+    svg.append('g')
+      .attr('transform', _translate(width * 0.5, height + 50))
+      .append('text')
+      .text(opts.Label)
+      .attr('class', 'label')
+      .attr('text-anchor', 'middle')
+      .attr('font-size', '1.1em')
+      .attr('font-weight', 'bold');
+  };
+
+  var pushGauge = function (data) {
+    d3.select('svg').remove();
+    if (data.Count > 0) {
+      gauge(toPoints(data), data);
+    }
   };
 
-  var scatterPlot = function (data, opts) {
+  // Draws the points of each group (a category, or no category) of a scatter
+  // plot, each category in its own color, with its least-squares fit.
+  var scatterPlot = function (groups, opts) {
+    var data = d3.merge(groups.map(function (g) { return g.points; }));
     if (data.length <= 1) {
       // TODO Show something/anything here instead of a blank screen
       return;
@@ -317,11 +697,10 @@
       .domain(d3.extent(data, function (d) { return d.y; }))
       .range([height, 0]);
 
-    var xAxis = d3.svg.axis().scale(x).orient('bottom');
-    var yAxis = d3.svg.axis().scale(y).orient('left');
-    d3.svg.line()
-      .x(function (d) { return x(d.x); })
-      .y(function (d) { return y(d.y); });
+    var xAxis = d3.svg.axis().scale(x).orient('bottom')
+      .tickFormat(unitFormat(opts.UnitX));
+    var yAxis = d3.svg.axis().scale(y).orient('left')
+      .tickFormat(unitFormat(opts.Unit));
 
     var svg = d3.select('body').append('svg')
       .attr('width', width + 65)
@@ -339,12 +718,56 @@
       .attr('font-size', '1.1em')
       .attr('font-weight', 'bold');
 
-    svg.selectAll('.dot').data(data)
-      .enter().append('circle')
-        .attr('class', 'dot')
-        .attr('r', 3.5)
-        .attr('cx', function(d) { return x(d.x); })
-        .attr('cy', function(d) { return y(d.y); });
+    svg.append('clipPath')
+      .attr('id', 'plot')
+      .append('rect')
+      .attr('width', width)
+      .attr('height', height);
+
+    var color = d3.scale.category10();
+    groups.forEach(function (g) {
+      var dots = svg.selectAll('.dot.group' + g.index).data(g.points)
+        .enter().append('circle')
+          .attr('class', 'dot group' + g.index)
+          .attr('r', 3.5)
+          .attr('cx', function(d) { return x(d.x); })
+          .attr('cy', function(d) { return y(d.y); });
+      if (g.name) {
+        dots.style('fill', color(g.name));
+      }
+
+      // The least-squares fit is drawn across the plot (clipped to it).
+      if (g.fit) {
+        var fit = function (x) {
+          return g.fit.Slope * x + g.fit.Intercept;
+        };
+        var trend = svg.append('line')
+          .attr('class', 'trend')
+          .attr('clip-path', 'url(#plot)')
+          .attr('x1', 0)
+          .attr('y1', y(fit(x.domain()[0])))
+          .attr('x2', width)
+          .attr('y2', y(fit(x.domain()[1])));
+        if (g.name) {
+          trend.style('stroke', color(g.name));
+        }
+      }
+    });
+
+    // The correlation coefficient of points with no category goes above.
+    if (opts.Fit) {
+      svg.append('text')
+        .text('r = ' + opts.Fit.Correlation.toFixed(3))
+        .attr('class', 'trend')
+        .attr('x', width)
+        .attr('y', -12)
+        .attr('text-anchor', 'end');
+    }
+
+    var names = groups.map(function (g) { return g.name; }).filter(Boolean);
+    if (names.length > 0) {
+      legend(svg, names, color, width);
+    }
 
     svg.append('g')
       .attr('class', 'y axis')
@@ -358,11 +781,155 @@
   };
 
   var pushScatterPlot = function (data) {
-    var sp = d3.map(data.Values).entries().map(function (i) {
-      return {x: parseFloat(i.key.split('|')[0]), y: i.value};
+    // Values is an array of [x, y] pairs, updated by index.
+    var toGroup = function (name, points, index) {
+      return {
+        name: name,
+        index: index,
+        fit: points.Fit,
+        points: d3.values(points.Values).map(function (pair) {
+          return {x: pair[0], y: pair[1]};
+        })
+      };
+    };
+    var groups = [toGroup('', data, 0)];
+    d3.keys(data.Series || {}).sort().forEach(function (name, i) {
+      groups.push(toGroup(name, data.Series[name], i + 1));
     });
     d3.select('svg').remove();
-    scatterPlot(sp, data);
+    scatterPlot(groups, data);
+  };
+
+  // Draws a box for each group of a box plot, side by side: spanning the
+  // quartiles, split at the median, with whiskers and a dot for each outlier.
+  var boxPlot = function (boxes, opts) {
+    if (boxes.length === 0) {
+      // TODO Show something/anything here instead of a blank screen
+      return;
+    }
+
+    applyStyle(opts);
+
+    var width = opts.Width;
+    var height = opts.Height;
+
+    var x = d3.scale.ordinal()
+      .domain(boxes.map(function (b) { return b.name; }))
+      .rangeRoundBands([0, width], 0.3);
+
+    var values = d3.merge(boxes.map(function (b) {
+      return b.Outliers.concat([b.Low, b.High]);
+    }));
+    var y = d3.scale.linear()
+      .domain(d3.extent(values))
+      .range([height, 0])
+      .nice();
+
+    var xAxis = d3.svg.axis().scale(x).orient('bottom');
+    var yAxis = d3.svg.axis().scale(y).orient('left')
+      .tickFormat(unitFormat(opts.Unit));
+
+    var svg = d3.select('body').append('svg')
+      .attr('width', width + 65)
+      .attr('height', height + 105)
+      .append('g')
+      .attr('transform', _translate(50, 50));
+      // TODO Use axis/svg width for translate instead of hard-coding
+
+    svg.append('g')
+      .attr('transform', _translate(width * 0.5, height + 50))
+      .append('text')
+      .text(opts.Label)
+      .attr('class', 'label')
+      .attr('text-anchor', 'middle')
+      .attr('font-size', '1.1em')
+      .attr('font-weight', 'bold');
+
+    var band = x.rangeBand();
+    var box = svg.selectAll('.box').data(boxes)
+      .enter()
+      .append('g')
+      .attr('class', 'box')
+      .attr('transform', function (d) { return _translate(x(d.name), 0); });
+
+    box.append('line')
+      .attr('class', 'whisker')
+      .attr('x1', band * 0.5)
+      .attr('x2', band * 0.5)
+      .attr('y1', function (d) { return y(d.Low); })
+      .attr('y2', function (d) { return y(d.High); });
+    ['Low', 'High'].forEach(function (end) {
+      box.append('line')
+        .attr('class', 'whisker')
+        .attr('x1', band * 0.25)
+        .attr('x2', band * 0.75)
+        .attr('y1', function (d) { return y(d[end]); })
+        .attr('y2', function (d) { return y(d[end]); });
+    });
+    box.append('rect')
+      .attr('width', band)
+      .attr('y', function (d) { return y(d.Q3); })
+      .attr('height', function (d) {
+        return Math.max(1, y(d.Q1) - y(d.Q3));
+      });
+    box.append('line')
+      .attr('class', 'median')
+      .attr('x2', band)
+      .attr('y1', function (d) { return y(d.Median); })
+      .attr('y2', function (d) { return y(d.Median); });
+    box.selectAll('.outlier')
+      .data(function (d) { return d.Outliers; })
+      .enter().append('circle')
+        .attr('class', 'outlier')
+        .attr('r', 2.5)
+        .attr('cx', band * 0.5)
+        .attr('cy', function (d) { return y(d); });
+
+    svg.append('g')
+      .attr('class', 'y axis')
+      .call(yAxis);
+
+    svg.append('g')
+      .attr('class', 'x axis')
+      .attr('transform', _translate(0, height))
+      .call(xAxis);
+  };
+
+  var pushBoxPlot = function (data) {
+    var boxes = d3.entries(data.Values).map(function (i) {
+      i.value.name = i.key;
+      return i.value;
+    });
+    boxes.sort(function (a, b) { return d3.ascending(a.name, b.name); });
+    d3.select('svg').remove();
+    boxPlot(boxes, data);
+  };
+
+  var escapeHTML = function (str) {
+    return str.replace(/&/g, '&amp;')
+      .replace(/</g, '&lt;')
+      .replace(/>/g, '&gt;');
+  };
+
+  // Returns the HTML for a log line, with each highlighted span (an array of
+  // its start, end and the index of the rule it matched) marked in the color
+  // of its rule. Overlapping spans are skipped.
+  var highlightColor = d3.scale.category10();
+  var highlightLine = function (line, spans) {
+    var html = '';
+    var end = 0;
+    (spans || []).slice().sort(function (a, b) {
+      return d3.ascending(a[0], b[0]);
+    }).forEach(function (span) {
+      if (span[0] < end) {
+        return;
+      }
+      html += escapeHTML(line.slice(end, span[0]));
+      html += '<mark style="background-color: ' + highlightColor(span[2]) +
+        '">' + escapeHTML(line.slice(span[0], span[1])) + '</mark>';
+      end = span[1];
+    });
+    return html + escapeHTML(line.slice(end));
   };
 
   var state = {lastLine: 0, lastLabel: null};
@@ -378,8 +945,10 @@
       logLines = d3.select('body').append('pre').classed('lines', true);
     }
     d3.range(state.lastLine, data.Count).forEach(function (i) {
-      var val = data.Values[i.toString()];
+      var key = i.toString();
+      var val = data.Values[key];
       if (val !== undefined) {
+        val = highlightLine(val, (data.Highlights || {})[key]);
         val = '<span>[' + new Date().toISOString() + ']</span> ' + val;
         logLines.html(logLines.html() + val + '\n');
       }
@@ -389,11 +958,109 @@
     state.lastLabel = data.Label;
   };
 
+  // Compares table cells, numerically if they're both numbers.
+  var compareCells = function (a, b) {
+    if (typeof a === 'number' && typeof b === 'number') {
+      return d3.ascending(a, b);
+    }
+    return d3.ascending(cellText(a), cellText(b));
+  };
+
+  var cellText = function (val) {
+    if (val === undefined || val === null) {
+      return '';
+    }
+    return typeof val === 'object' ? JSON.stringify(val) : String(val);
+  };
+
+  // Draws the rows of a table, oldest first unless sorted by a column (by
+  // clicking its header; clicking again reverses the order).
+  var tableState = {column: null, descending: false};
+  var pushTable = function (data) {
+    applyStyle(data);
+    d3.select('table.rows').remove();
+
+    var rows = d3.entries(data.Values);
+    rows.sort(function (a, b) {
+      var order = d3.ascending(+a.key, +b.key);
+      if (tableState.column !== null) {
+        order = compareCells(a.value[tableState.column],
+                             b.value[tableState.column]) || order;
+      }
+      return tableState.descending ? -order : order;
+    });
+
+    var tab = d3.select('body').append('table').classed('rows', true);
+    tab.append('thead').append('tr')
+      .selectAll('th').data(data.Columns)
+      .enter().append('th')
+        .text(function (d) {
+          var arrow = tableState.descending ? ' \u25be' : ' \u25b4';
+          return d + (d === tableState.column ? arrow : '');
+        })
+        .on('click', function (d) {
+          tableState.descending = d === tableState.column &&
+            !tableState.descending;
+          tableState.column = d;
+          pushTable(data);
+        });
+    tab.append('tbody')
+      .selectAll('tr').data(rows)
+      .enter().append('tr')
+        .selectAll('td').data(function (row) {
+          return data.Columns.map(function (c) { return row.value[c]; });
+        })
+        .enter().append('td')
+          .text(cellText);
+  };
+
   var pushFuncs = {
     'histogram': pushHistogram,
+    'categories': pushCategories,
+    'heatmap': pushHeatmap,
+    'gauge': pushGauge,
     'time-series': pushTimeSeries,
     'scatterplot': pushScatterPlot,
-    'logfile': pushLogFile
+    'boxplot': pushBoxPlot,
+    'logfile': pushLogFile,
+    'table': pushTable
+  };
+
+  // Applies a partial update of a graph (as sent by the server when only some
+  // of its values have changed) to the last known state of that graph.
+  // Complete graphs replace the last known state.
+  var applyDelta = function (graph, delta) {
+    if (!delta.Partial) {
+      return delta;
+    }
+    if (!graph) {
+      return null;
+    }
+    var merged = ['Values', 'Bounds', 'Rollups', 'Highlights', 'Smoothed'];
+    d3.entries(delta).forEach(function (item) {
+      if (merged.indexOf(item.key) >= 0) {
+        graph[item.key] = graph[item.key] || {};
+        d3.entries(item.value).forEach(function (value) {
+          graph[item.key][value.key] = value.value;
+        });
+      } else if (item.key === 'Series') {
+        graph.Series = graph.Series || {};
+        d3.entries(item.value).forEach(function (series) {
+          graph.Series[series.key] = applyDelta(
+            graph.Series[series.key] || {Values: {}}, series.value);
+        });
+      } else if (item.key !== 'Removed' && item.key !== 'Partial') {
+        graph[item.key] = item.value;
+      }
+    });
+    (delta.Removed || []).forEach(function (key) {
+      merged.forEach(function (name) {
+        if (graph[name]) {
+          delete graph[name][key];
+        }
+      });
+    });
+    return graph;
   };
 
   var graphs = {};
@@ -410,13 +1077,47 @@
     } else {
       console.log('New graph:', data.name);
     }
+    var graph = null;
     events.addEventListener(data.name, function (e) {
-      var graph = JSON.parse(e.data);
-      console.debug(data.name, graph);
-      pushFuncs[graph.Layout](graph);
+      var delta = JSON.parse(e.data);
+      console.debug(data.name, delta);
+      graph = applyDelta(graph, delta);
+      if (graph) {
+        pushFuncs[graph.Layout](graph);
+      }
     }, false);
   }, false);
 
+  // Alerts for the graph being shown are listed until they're resolved.
+  var alerts = {};
+  events.addEventListener('__alert', function (e) {
+    var alert = JSON.parse(e.data);
+    if (alert.Graph !== window.graph) {
+      return;
+    }
+    var key = alert.Series || '';
+    if (alert.State === 'firing') {
+      alerts[key] = alert;
+    } else {
+      delete alerts[key];
+    }
+
+    var list = d3.select('div.alerts');
+    if (list.empty()) {
+      list = d3.select('body').append('div').classed('alerts', true);
+    }
+    var entries = list.selectAll('div').data(d3.values(alerts), function (d) {
+      return d.Series;
+    });
+    entries.enter().append('div');
+    entries.exit().remove();
+    entries.text(function (d) {
+      var name = d.Series ? d.Series + ': ' : '';
+      return name + d.Value + ' crossed ' + d.Threshold + ' at ' +
+        new Date(d.Time).toLocaleTimeString();
+    });
+  }, false);
+
   // TODO Indicate EOF/disconnect to the user
   // TODO Auto-resize graphs when window size changes
 })();
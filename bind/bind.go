@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Parameters map a field name to one or more values.
@@ -64,6 +65,16 @@ var allConvertibleTypes = convertibleTypes{
 			converted, err := strconv.ParseBool(val)
 			return reflect.ValueOf(converted), err
 		}},
+	// Conversion info for durations.
+	convertibleType{
+		Type: reflect.TypeOf((*time.Duration)(nil)).Elem(),
+		FlagFunc: func(f *flag.FlagSet) reflect.Value {
+			return reflect.ValueOf(f.DurationVar)
+		},
+		ConvertFrom: func(val string) (reflect.Value, error) {
+			converted, err := time.ParseDuration(val)
+			return reflect.ValueOf(converted), err
+		}},
 	// Conversion info for strings.
 	convertibleType{
 		Type: reflect.TypeOf((*string)(nil)).Elem(),
@@ -106,8 +117,8 @@ func GenerateFlags(bindable interface{}, name string) (*flag.FlagSet, bool) {
 		field := bindType.Field(i)
 		fieldValue := bindValue.Field(i)
 
-		// Skip fields that don't have a tag.
-		if len(field.Tag) == 0 {
+		// Skip fields that don't have a tag, or that must not be bound.
+		if len(field.Tag) == 0 || field.Tag.Get("bind") == "-" {
 			continue
 		}
 
@@ -146,7 +157,8 @@ func GenerateFlags(bindable interface{}, name string) (*flag.FlagSet, bool) {
 }
 
 // Bind sets the fields of an arbitary struct value (from a pointer) from
-// a map of string values.
+// a map of string values. The fields of embedded struct pointers are set too.
+// Fields tagged `bind:"-"` are never set.
 func Bind(bindable interface{}, params Parameters) bool {
 	structType, structValue, ok := inspect(bindable)
 	if !ok {
@@ -156,9 +168,17 @@ func Bind(bindable interface{}, params Parameters) bool {
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
 
-		// Skip fields that don't have a value in params.
+		// Descend into embedded structs.
+		embedded := structValue.Field(i)
+		if field.Anonymous && embedded.Kind() == reflect.Ptr && !embedded.IsNil() {
+			Bind(embedded.Interface(), params)
+			continue
+		}
+
+		// Skip fields that must not be bound, or don't have a value in
+		// params.
 		paramValues, ok := params[strings.ToLower(field.Name)]
-		if !ok {
+		if !ok || field.Tag.Get("bind") == "-" {
 			continue
 		}
 
@@ -2,6 +2,7 @@ package bind
 
 import (
 	"testing"
+	"time"
 )
 
 type TestStruct struct {
@@ -11,6 +12,13 @@ type TestStruct struct {
 	Barf  map[string]string
 	Float float64
 	Bool  bool
+	Dur   time.Duration `default:"1m"`
+}
+
+type EmbeddingStruct struct {
+	*TestStruct
+	Baz    int
+	Secret string `bind:"-"`
 }
 
 func TestBind(t *testing.T) {
@@ -21,6 +29,7 @@ func TestBind(t *testing.T) {
 		"quux":  []string{"3", "4", "5"},
 		"float": []string{"6"},
 		"bool":  []string{"true"},
+		"dur":   []string{"5s"},
 	})
 	if f.Foo != 1 {
 		t.Error("Failed to bind int value")
@@ -37,6 +46,27 @@ func TestBind(t *testing.T) {
 	if !f.Bool {
 		t.Error("Failed to bind bool value")
 	}
+	if f.Dur != 5*time.Second {
+		t.Error("Failed to bind duration value")
+	}
+}
+
+func TestBindEmbedded(t *testing.T) {
+	f := &EmbeddingStruct{TestStruct: &TestStruct{}}
+	Bind(f, map[string][]string{
+		"foo":    []string{"1"},
+		"baz":    []string{"2"},
+		"secret": []string{"3"},
+	})
+	if f.Foo != 1 {
+		t.Error("Failed to bind embedded value")
+	}
+	if f.Baz != 2 {
+		t.Error("Failed to bind value alongside embedded struct")
+	}
+	if f.Secret != "" {
+		t.Error("Bound a value that must not be bound")
+	}
 }
 
 func TestGenerateFlags(t *testing.T) {
@@ -62,4 +92,7 @@ func TestGenerateFlags(t *testing.T) {
 	if f.Bool {
 		t.Error("Failed to bind bool value")
 	}
+	if f.Dur != time.Minute {
+		t.Error("Failed to bind duration value")
+	}
 }
@@ -0,0 +1,241 @@
+package graphblast
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Box summarizes the distribution of the values retained for a group of a
+// BoxPlot. The whiskers reach the most extreme values within 1.5 times the
+// interquartile range of the quartiles, and values beyond them are outliers.
+type Box struct {
+	Low      Countable   // the lower whisker
+	Q1       Countable   // the first quartile
+	Median   Countable   // the median
+	Q3       Countable   // the third quartile
+	High     Countable   // the upper whisker
+	Outliers []Countable // the values beyond the whiskers
+	Count    int         // the number of values retained
+}
+
+// newBox returns the box summarizing some sorted values.
+func newBox(sorted []Countable) *Box {
+	box := &Box{
+		Q1:     quartile(sorted, 0.25),
+		Median: quartile(sorted, 0.5),
+		Q3:     quartile(sorted, 0.75),
+		Count:  len(sorted)}
+
+	reach := (box.Q3 - box.Q1) * 1.5
+	low := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i] >= box.Q1-reach
+	})
+	high := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i] > box.Q3+reach
+	})
+	if low >= high {
+		// The whiskers can't be placed (such as for a NaN reach), so they
+		// reach all of the values.
+		low, high = 0, len(sorted)
+	}
+	box.Low, box.High = sorted[low], sorted[high-1]
+	box.Outliers = make([]Countable, 0, low+len(sorted)-high)
+	box.Outliers = append(box.Outliers, sorted[:low]...)
+	box.Outliers = append(box.Outliers, sorted[high:]...)
+	return box
+}
+
+// quartile returns the q quantile of sorted values, interpolating between the
+// values on either side of it.
+func quartile(sorted []Countable, q float64) Countable {
+	pos := q * float64(len(sorted)-1)
+	i := int(math.Floor(pos))
+	if i+1 >= len(sorted) {
+		return sorted[i]
+	}
+	frac := Countable(pos - float64(i))
+	return sorted[i] + (sorted[i+1]-sorted[i])*frac
+}
+
+// group holds the latest values of a group of a BoxPlot, both in the order
+// they were added and sorted.
+type group struct {
+	values  []Countable
+	sorted  []Countable
+	next    int // the index of the oldest value, once the window is full
+	updated int // the indicator of the latest value added
+}
+
+// add stores a value, in place of the oldest one if the window is full.
+func (g *group) add(val Countable, window int) {
+	if window <= 0 || len(g.values) < window {
+		g.values = append(g.values, val)
+	} else {
+		g.remove(g.values[g.next])
+		g.values[g.next] = val
+		g.next = (g.next + 1) % len(g.values)
+	}
+	g.insert(val)
+}
+
+// insert adds a value to the sorted values.
+func (g *group) insert(val Countable) {
+	i := sort.Search(len(g.sorted), func(i int) bool { return g.sorted[i] >= val })
+	g.sorted = append(g.sorted, 0)
+	copy(g.sorted[i+1:], g.sorted[i:])
+	g.sorted[i] = val
+}
+
+// remove drops a value from the sorted values.
+func (g *group) remove(val Countable) {
+	i := sort.Search(len(g.sorted), func(i int) bool { return g.sorted[i] >= val })
+	g.sorted = append(g.sorted[:i], g.sorted[i+1:]...)
+}
+
+// BoxPlot compares the distributions of the values of several groups, such
+// as the latencies of different endpoints, by the latest values of each.
+type BoxPlot struct {
+	sync.Mutex // held while the graph is read into or sent
+
+	*Input
+	Values  map[string]*Box // the box of each group
+	groups  map[string]*group
+	changes *changeLog
+
+	Layout string // the layout to use (interpreted by JS)
+	Label  string // the label of the graph
+	Width  int    // the maximum graph width in pixels
+	Height int    // the maximum graph height in pixels
+	Window int    // the number of values to retain per group, if > 0
+
+	// The number of groups to retain, if > 0. Once there are more, the
+	// least recently updated group is dropped.
+	MaxGroups int
+
+	// The field naming each value's group, named or numbered as Field is, or
+	// "" to take the group from the rest of a line that isn't the value
+	// (unless the value is found by Field or Extract, or isn't in text).
+	GroupField string
+
+	Allowed Range // the range of values to accept
+
+	Colors   string // the colors to use when displaying the graph
+	FontSize string // the CSS font size to use when displaying the graph
+
+	Count    int // the number of values encountered so far
+	Filtered int // the number of values filtered out so far
+	Errors   int // the number of values skipped due to errors so far
+}
+
+func NewBoxPlot() *BoxPlot {
+	return &BoxPlot{
+		Input:     NewInput(),
+		Values:    make(map[string]*Box),
+		groups:    make(map[string]*group),
+		changes:   newChangeLog(),
+		Layout:    "boxplot",
+		Window:    1000,
+		MaxGroups: 20,
+		Allowed:   Range{Countable(math.Inf(-1)), Countable(math.Inf(1))}}
+}
+
+func (bp *BoxPlot) Changed(indicator int) (bool, int) {
+	if bp.Count <= indicator {
+		return false, indicator
+	}
+	return true, bp.Count
+}
+
+// Add adds a value with no group.
+func (bp *BoxPlot) Add(val Countable, err error) {
+	bp.AddTo("", val, err)
+}
+
+// AddTo adds a value to the named group, and updates its box. Infinite
+// values are errors, since the box couldn't be drawn.
+func (bp *BoxPlot) AddTo(name string, val Countable, err error) {
+	if err == errFiltered {
+		bp.Filtered += 1
+		return
+	} else if err != nil || math.IsInf(float64(val), 0) {
+		bp.Errors += 1
+		return
+	} else if !bp.Allowed.Contains(val) {
+		bp.Filtered += 1
+		return
+	}
+
+	bp.Count += 1
+	g, ok := bp.groups[name]
+	if !ok {
+		if bp.MaxGroups > 0 && len(bp.groups) >= bp.MaxGroups {
+			bp.dropGroup()
+		}
+		g = &group{}
+		bp.groups[name] = g
+	}
+	g.add(val, bp.Window)
+	g.updated = bp.Count
+
+	bp.Values[name] = newBox(g.sorted)
+	bp.changes.Update(name, bp.Count)
+}
+
+// dropGroup drops the least recently updated group.
+func (bp *BoxPlot) dropGroup() {
+	least := ""
+	found := false
+	for name, g := range bp.groups {
+		if !found || g.updated < bp.groups[least].updated {
+			least, found = name, true
+		}
+	}
+	delete(bp.groups, least)
+	delete(bp.Values, least)
+	bp.changes.Remove(least, bp.Count)
+}
+
+// Delta returns the boxes of the groups that have changed since the indicator
+// value was returned by Changed, or the whole graph if they are no longer
+// known.
+func (bp *BoxPlot) Delta(indicator int) interface{} {
+	return keyedDelta(bp, bp.changes, indicator, "Values")
+}
+
+// Read reads lines of a group and a value. Unless they're found by Field,
+// Extract and GroupField, the value is the last field of a line, and the
+// group is the rest of it, if any.
+func (bp *BoxPlot) Read(reader io.Reader) error {
+	return doRead(reader, bp, func(line string) {
+		name, value, err := bp.splitLine(strings.TrimSpace(line))
+		if err == errSkipped {
+			return
+		}
+		val, err := bp.parse(value, err)
+		bp.AddTo(name, val, err)
+	})
+}
+
+// splitLine separates a line into the name of a group and the text of a
+// value.
+func (bp *BoxPlot) splitLine(line string) (string, string, error) {
+	found := bp.Field != "" || bp.Extract != "" || bp.GroupField != ""
+	if !bp.json() && !bp.csv() && !found {
+		name := ""
+		if i := strings.LastIndexAny(line, " \t"); i >= 0 {
+			name = strings.TrimSpace(line[:i])
+			line = line[i+1:]
+		}
+		return name, line, nil
+	}
+
+	value, err := bp.Value(line)
+	if err != nil || bp.GroupField == "" {
+		return "", value, err
+	}
+	name, err := bp.column(line, bp.GroupField)
+	return name, value, err
+}
@@ -0,0 +1,168 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBoxPlotAdd(t *testing.T) {
+	bp := NewBoxPlot()
+	for _, val := range []Countable{5, 1, 4, 2, 3, 100} {
+		bp.Add(val, nil)
+	}
+
+	box := bp.Values[""]
+	if box == nil || box.Count != 6 {
+		t.Fatalf("Add did not record values (%v)", bp.Values)
+	}
+	if box.Q1 != 2.25 || box.Median != 3.5 || box.Q3 != 4.75 {
+		t.Errorf("Add computed the wrong quartiles (%+v)", box)
+	}
+	if box.Low != 1 || box.High != 5 {
+		t.Errorf("Add computed the wrong whiskers (%+v)", box)
+	}
+	if len(box.Outliers) != 1 || box.Outliers[0] != 100 {
+		t.Errorf("Add found the wrong outliers (%v)", box.Outliers)
+	}
+}
+
+func TestBoxPlotAddError(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Allowed = Range{Countable(0), Countable(10)}
+	bp.Add(1, errors.New("fail"))
+	bp.Add(11, nil)
+
+	if len(bp.Values) != 0 {
+		t.Error("Add recorded a bad value")
+	}
+	if bp.Count != 0 || bp.Filtered != 1 || bp.Errors != 1 {
+		t.Error("Add recorded wrong count stat")
+	}
+}
+
+func TestBoxPlotAddInfinite(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Read(strings.NewReader("a 1\na inf\na -inf\na nan\n"))
+
+	if bp.Count != 1 || bp.Errors != 2 || bp.Filtered != 1 {
+		t.Errorf("Read accepted values that aren't finite (%v, %v, %v)", bp.Count, bp.Errors, bp.Filtered)
+	}
+	if box := newBox([]Countable{1, Countable(math.Inf(1))}); box.Low != 1 || len(box.Outliers) != 0 {
+		t.Errorf("newBox placed the whiskers wrongly for an infinite value (%+v)", box)
+	}
+}
+
+func TestBoxPlotAddWindow(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Window = 3
+	for _, val := range []Countable{1, 2, 3, 4, 5} {
+		bp.AddTo("a", val, nil)
+	}
+
+	box := bp.Values["a"]
+	if box.Count != 3 || box.Low != 3 || box.High != 5 {
+		t.Errorf("Add didn't window the values (%+v)", box)
+	}
+}
+
+func TestBoxPlotAddSorted(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Window = 5
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		bp.Add(Countable(random.Intn(10)), nil)
+	}
+
+	g := bp.groups[""]
+	sorted := append([]Countable{}, g.values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if !reflect.DeepEqual(sorted, g.sorted) {
+		t.Errorf("Add didn't keep the window sorted (%v, %v)", g.values, g.sorted)
+	}
+}
+
+func TestBoxPlotAddMaxGroups(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.MaxGroups = 2
+	bp.AddTo("a", 1, nil)
+	bp.AddTo("b", 2, nil)
+	bp.AddTo("a", 3, nil)
+	_, indicator := bp.Changed(0)
+	bp.AddTo("c", 4, nil)
+
+	if _, ok := bp.Values["b"]; ok || len(bp.Values) != 2 || len(bp.groups) != 2 {
+		t.Errorf("AddTo didn't drop the least recently updated group (%v)", bp.Values)
+	}
+	delta, _ := json.Marshal(bp.Delta(indicator))
+	if !strings.Contains(string(delta), `"Removed":["b"]`) {
+		t.Errorf("Delta didn't include the group dropped (%s)", delta)
+	}
+}
+
+func TestBoxPlotReadJSON(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Format = "json"
+	bp.Field = "took"
+	bp.GroupField = "path"
+	bp.Unit = "ms"
+	bp.Read(strings.NewReader(`{"path": "/a", "took": "1s"}` + "\n" + `{"took": 5}` + "\n"))
+
+	if bp.Count != 1 || bp.Errors != 1 {
+		t.Errorf("Read failed to read the input (%v, %v)", bp.Count, bp.Errors)
+	}
+	if box := bp.Values["/a"]; box == nil || box.Median != 1000 {
+		t.Errorf("Read stored the wrong groups (%v)", bp.Values)
+	}
+}
+
+func TestBoxPlotReadExtract(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Extract = `took (\d+)`
+	bp.Read(strings.NewReader("GET /a took 10\nGET /a failed\n"))
+
+	if bp.Count != 1 || bp.Filtered != 1 || bp.Values[""].Median != 10 {
+		t.Errorf("Read didn't extract the values (%v)", bp.Values)
+	}
+}
+
+func TestBoxPlotRead(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.Unit = "ms"
+	bp.Read(strings.NewReader("GET /a 10\nGET /a 1s\n/b\t5ms\n7\nGET /a x\n"))
+
+	if bp.Count != 4 || bp.Errors != 1 {
+		t.Errorf("Read failed to read the input (%v, %v)", bp.Count, bp.Errors)
+	}
+	if len(bp.Values) != 3 || bp.Values["GET /a"].High != 1000 {
+		t.Errorf("Read stored the wrong groups (%v)", bp.Values)
+	}
+	if bp.Values["/b"].Median != 5 || bp.Values[""].Median != 7 {
+		t.Error("Read stored the wrong values")
+	}
+}
+
+func TestBoxPlotDelta(t *testing.T) {
+	bp := NewBoxPlot()
+	bp.AddTo("a", 1, nil)
+	_, indicator := bp.Changed(0)
+	bp.AddTo("b", 2, nil)
+
+	delta, err := json.Marshal(bp.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	text := string(delta)
+	if !strings.Contains(text, `"Values":{"b":{"Low":2,`) || strings.Contains(text, `"a"`) {
+		t.Errorf("Delta included the wrong groups (%s)", text)
+	}
+
+	if bp.Delta(0) != bp {
+		t.Error("Delta did not return the whole box plot for old changes")
+	}
+}
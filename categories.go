@@ -0,0 +1,195 @@
+package graphblast
+
+import (
+	"container/heap"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Categories counts the distinct values of lines, keeping the most frequent.
+// To bound memory for values with high cardinality, only a limited number of
+// values are counted at once, using the Space-Saving algorithm (Metwally et
+// al., "Efficient Computation of Frequent and Top-k Elements in Data
+// Streams"): a new value takes the place of the least frequent one, inheriting
+// its count, so the counts of rarer values may be overestimated.
+type Categories struct {
+	sync.Mutex // held while the graph is read into or sent
+
+	Values  map[string]Countable // the counts of the most frequent values
+	counts  map[string]*entry    // the counts of all values being counted
+	counted *entries             // of the values being counted
+	shown   *entries             // of the values in Values
+	changes *changeLog
+
+	Layout   string // the layout to use (interpreted by JS)
+	Label    string // the label of the graph
+	Wide     bool   // whether to use the alternate wide graph orientation
+	Width    int    // the maximum graph width in pixels
+	Height   int    // the maximum graph height in pixels
+	Top      int    // the number of most frequent values to display
+	Capacity int    // the number of distinct values to count at once
+
+	Colors   string // the colors to use when displaying the graph
+	FontSize string // the CSS font size to use when displaying the graph
+
+	Count    int       // the number of values encountered so far
+	Other    Countable // the number of values not among the most frequent
+	Filtered int       // the number of values filtered out so far
+	Errors   int       // the number of values skipped due to errors so far
+}
+
+func NewCategories() *Categories {
+	return &Categories{
+		Layout:   "categories",
+		Values:   make(map[string]Countable),
+		counts:   make(map[string]*entry, 1024),
+		counted:  newEntries(func(e *entry) *int { return &e.counted }),
+		shown:    newEntries(func(e *entry) *int { return &e.shown }),
+		changes:  newChangeLog(),
+		Top:      10,
+		Capacity: 1000}
+}
+
+func (c *Categories) Changed(indicator int) (bool, int) {
+	if c.Count <= indicator {
+		return false, indicator
+	}
+	return true, c.Count
+}
+
+// Add counts a value. Empty values are filtered out.
+func (c *Categories) Add(val string, err error) {
+	if err != nil {
+		c.Errors += 1
+		return
+	} else if val == "" {
+		c.Filtered += 1
+		return
+	}
+
+	c.Count += 1
+	c.Other += 1
+	e := c.counts[val]
+	if e == nil {
+		e = &entry{val: val, shown: -1}
+		if len(c.counts) >= c.capacity() {
+			e.count = c.evict()
+		}
+		c.counts[val] = e
+		heap.Push(c.counted, e)
+	}
+	e.count += 1
+	heap.Fix(c.counted, e.counted)
+	c.rank(e)
+}
+
+// capacity returns the number of values to count at once, which is never
+// less than the number displayed.
+func (c *Categories) capacity() int {
+	if c.Capacity < c.Top {
+		return c.Top
+	}
+	return c.Capacity
+}
+
+// evict stops counting the least frequent value, returning its count.
+func (c *Categories) evict() int {
+	least := heap.Pop(c.counted).(*entry)
+	delete(c.counts, least.val)
+	if least.shown >= 0 {
+		c.hide(least)
+	}
+	return least.count
+}
+
+// rank updates the displayed values after the count of a value has changed,
+// displacing the least frequent value displayed if it's now more frequent.
+func (c *Categories) rank(e *entry) {
+	if e.shown >= 0 {
+		heap.Fix(c.shown, e.shown)
+	} else if c.shown.Len() < c.Top {
+		heap.Push(c.shown, e)
+	} else if c.shown.Len() > 0 && e.count > c.shown.least().count {
+		c.hide(c.shown.least())
+		heap.Push(c.shown, e)
+	} else {
+		return
+	}
+	c.Other -= Countable(e.count) - c.Values[e.val]
+	c.Values[e.val] = Countable(e.count)
+	c.changes.Update(e.val, c.Count)
+}
+
+// hide stops displaying a value, counting it among the other values instead.
+func (c *Categories) hide(e *entry) {
+	heap.Remove(c.shown, e.shown)
+	c.Other += c.Values[e.val]
+	delete(c.Values, e.val)
+	c.changes.Remove(e.val, c.Count)
+}
+
+// entry is the count of a value, and its place in the heaps holding it.
+type entry struct {
+	val     string
+	count   int
+	counted int // the index of the entry in counted
+	shown   int // the index of the entry in shown, or -1 if it isn't shown
+}
+
+// entries is a min-heap of entries by count (see container/heap), which keeps
+// the index of each entry in it up to date.
+type entries struct {
+	heap  []*entry
+	index func(e *entry) *int // where an entry's index in the heap is kept
+}
+
+func newEntries(index func(e *entry) *int) *entries {
+	return &entries{index: index}
+}
+
+// least returns the entry with the lowest count.
+func (es *entries) least() *entry {
+	return es.heap[0]
+}
+
+func (es *entries) Len() int {
+	return len(es.heap)
+}
+
+func (es *entries) Less(i, j int) bool {
+	return es.heap[i].count < es.heap[j].count
+}
+
+func (es *entries) Swap(i, j int) {
+	es.heap[i], es.heap[j] = es.heap[j], es.heap[i]
+	*es.index(es.heap[i]) = i
+	*es.index(es.heap[j]) = j
+}
+
+func (es *entries) Push(x interface{}) {
+	e := x.(*entry)
+	*es.index(e) = len(es.heap)
+	es.heap = append(es.heap, e)
+}
+
+func (es *entries) Pop() interface{} {
+	last := len(es.heap) - 1
+	e := es.heap[last]
+	es.heap[last] = nil
+	es.heap = es.heap[:last]
+	*es.index(e) = -1
+	return e
+}
+
+// Delta returns the counts that have changed since the indicator value was
+// returned by Changed, or the whole graph if they are no longer known.
+func (c *Categories) Delta(indicator int) interface{} {
+	return keyedDelta(c, c.changes, indicator, "Values")
+}
+
+func (c *Categories) Read(reader io.Reader) error {
+	return doRead(reader, c, func(line string) {
+		c.Add(strings.TrimSpace(line), nil)
+	})
+}
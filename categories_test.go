@@ -0,0 +1,106 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCategoriesAdd(t *testing.T) {
+	c := NewCategories()
+	c.Add("200", nil)
+	c.Add("200", nil)
+	c.Add("404", nil)
+	if c.Count != 3 {
+		t.Error("Add didn't increment the count")
+	}
+	if c.Values["200"] != 2 || c.Values["404"] != 1 {
+		t.Errorf("Add didn't count the values (%v)", c.Values)
+	}
+	if c.Other != 0 {
+		t.Errorf("Add counted shown values as other (%v)", c.Other)
+	}
+
+	c.Add("", nil)
+	c.Add("500", errors.New("fail"))
+	if c.Filtered != 1 || c.Errors != 1 || c.Count != 3 {
+		t.Error("Add counted an empty value or an error")
+	}
+}
+
+func TestCategoriesAddTop(t *testing.T) {
+	c := NewCategories()
+	c.Top = 2
+	c.Read(strings.NewReader("a\na\nb\nc\nc\nc\n"))
+	if len(c.Values) != 2 || c.Values["c"] != 3 || c.Values["a"] != 2 {
+		t.Errorf("Add didn't keep the most frequent values (%v)", c.Values)
+	}
+	if c.Other != 1 {
+		t.Errorf("Add didn't count the other values (%v)", c.Other)
+	}
+}
+
+func TestCategoriesAddCapacity(t *testing.T) {
+	c := NewCategories()
+	c.Top = 1
+	c.Capacity = 2
+	c.Read(strings.NewReader("a\na\na\nb\nc\nd\n"))
+	if len(c.counts) != 2 {
+		t.Errorf("Add counted too many values (%v)", c.counts)
+	}
+	if c.Values["a"] != 3 {
+		t.Errorf("Add lost the most frequent value (%v)", c.Values)
+	}
+	if c.counts["d"].count != 3 {
+		t.Errorf("Add didn't inherit the evicted count (%v)", c.counts)
+	}
+	if c.Other != 3 {
+		t.Errorf("Add didn't count the other values (%v)", c.Other)
+	}
+}
+
+func TestCategoriesDelta(t *testing.T) {
+	c := NewCategories()
+	c.Top = 1
+	c.Add("a", nil)
+	_, last := c.Changed(0)
+	c.Add("b", nil)
+	c.Add("b", nil)
+
+	delta, err := json.Marshal(c.Delta(last))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	if !strings.Contains(string(delta), `"Values":{"b":2}`) {
+		t.Errorf("Delta returned the wrong values (%s)", delta)
+	}
+	if !strings.Contains(string(delta), `"Removed":["a"]`) {
+		t.Errorf("Delta didn't return the displaced value (%s)", delta)
+	}
+}
+
+func TestCategoriesAddOther(t *testing.T) {
+	c := NewCategories()
+	c.Top = 3
+	c.Capacity = 5
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		c.Add(strconv.Itoa(random.Intn(20)), nil)
+
+		other := Countable(c.Count)
+		for _, shown := range c.Values {
+			other -= shown
+		}
+		if c.Other != other || len(c.Values) > c.Top || len(c.counts) > c.Capacity {
+			t.Fatalf("Add didn't keep the counts consistent (%v, %v)", c.Other, c.Values)
+		}
+		for val, shown := range c.Values {
+			if c.counts[val] == nil || Countable(c.counts[val].count) != shown {
+				t.Fatalf("Add showed a stale count for %v", val)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Gauge shows the latest value, with a short trail of the values before it,
+// and a level based on how it compares with warning and critical thresholds.
+type Gauge struct {
+	sync.Mutex // held while the graph is read into or sent
+
+	*Alert
+	*Input
+
+	Values map[string]Countable // the trailing values, keyed by time
+	trail  *Series
+
+	Layout string // the layout to use (interpreted by JS)
+	Label  string // the label of the gauge
+	Width  int    // the maximum graph width in pixels
+	Height int    // the maximum graph height in pixels
+	Window int    // the number of trailing values to retain, if > 0
+
+	Warn     float64 // the threshold for the warning level
+	Critical float64 // the threshold for the critical level
+	Below    bool    // whether values below, not above, thresholds are bad
+
+	Allowed Range
+
+	Colors   string // the colors to use when displaying the graph
+	FontSize string // the CSS font size to use when displaying the graph
+
+	Value Countable // the latest value
+	Level string    // "ok", "warn" or "critical", depending on the value
+
+	Count    int // the number of values encountered so far
+	Filtered int // the number of values filtered out so far
+	Errors   int // the number of values skipped due to errors so far
+}
+
+// NewGauge returns a gauge with no thresholds set.
+func NewGauge() *Gauge {
+	values := make(map[string]Countable)
+	return &Gauge{
+		Alert:    NewAlert(),
+		Input:    NewInput(),
+		Values:   values,
+		trail:    newSeries(values),
+		Layout:   "gauge",
+		Window:   60,
+		Warn:     math.NaN(),
+		Critical: math.NaN(),
+		Allowed:  Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
+		Level:    "ok"}
+}
+
+func (g *Gauge) Changed(indicator int) (bool, int) {
+	if g.Count <= indicator {
+		return false, indicator
+	}
+	return true, g.Count
+}
+
+// Add records the latest value, read at a time.
+func (g *Gauge) Add(when time.Time, val Countable, err error) {
+	if err == errFiltered {
+		g.Filtered += 1
+		return
+	} else if err != nil {
+		g.Errors += 1
+		return
+	} else if !g.Allowed.Contains(val) {
+		g.Filtered += 1
+		return
+	}
+
+	g.Count += 1
+	g.Value = val
+	g.Level = g.level(val)
+	g.observe("", when, val)
+	g.trail.add(when, val, g.Count)
+	g.trail.evict(g.Count, g.Window, time.Time{})
+}
+
+// level returns the level of a value. Unset (NaN) thresholds are never
+// crossed.
+func (g *Gauge) level(val Countable) string {
+	crossed := func(threshold float64) bool {
+		if g.Below {
+			return float64(val) <= threshold
+		}
+		return float64(val) >= threshold
+	}
+	if crossed(g.Critical) {
+		return "critical"
+	} else if crossed(g.Warn) {
+		return "warn"
+	}
+	return "ok"
+}
+
+// plainGauge has the fields of a Gauge but none of its methods, so that it
+// can be marshaled as part of a gaugeView.
+type plainGauge Gauge
+
+// gaugeView is how a Gauge is marshaled: unset (NaN) thresholds are null.
+type gaugeView struct {
+	*plainGauge
+	Warn     *Countable
+	Critical *Countable
+}
+
+func (g *Gauge) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&gaugeView{
+		plainGauge: (*plainGauge)(g),
+		Warn:       finite(Countable(g.Warn)),
+		Critical:   finite(Countable(g.Critical))})
+}
+
+// Delta returns the trailing values that have changed since the indicator
+// value was returned by Changed, or the whole gauge if they are no longer
+// known.
+func (g *Gauge) Delta(indicator int) interface{} {
+	return keyedDelta(g, g.trail.changes, indicator, "Values")
+}
+
+func (g *Gauge) Read(reader io.Reader) error {
+	return g.read(reader, g, func(value string, err error) {
+		val, err := g.parse(value, err)
+		g.Add(time.Now(), val, err)
+	})
+}
@@ -0,0 +1,85 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGaugeAdd(t *testing.T) {
+	g := NewGauge()
+	g.Window = 2
+	start := time.Unix(1400000000, 0)
+	g.Add(start, 1, nil)
+	g.Add(start.Add(time.Second), 2, nil)
+	g.Add(start.Add(2*time.Second), 3, nil)
+	if g.Value != 3 {
+		t.Errorf("Add didn't record the latest value (%v)", g.Value)
+	}
+	if len(g.Values) != 2 || g.Values[start.Format(time.RFC3339Nano)] != 0 {
+		t.Errorf("Add didn't drop values beyond the window (%v)", g.Values)
+	}
+	if g.Level != "ok" {
+		t.Errorf("Add crossed an unset threshold (%v)", g.Level)
+	}
+
+	g.Add(start, 0, errors.New("fail"))
+	g.Allowed = Range{0, 10}
+	g.Add(start, 50, nil)
+	if g.Count != 3 || g.Errors != 1 || g.Filtered != 1 || g.Value != 3 {
+		t.Error("Add recorded an error or a filtered value")
+	}
+}
+
+func TestGaugeLevel(t *testing.T) {
+	g := NewGauge()
+	g.Warn = 10
+	g.Critical = 20
+	levels := map[Countable]string{5: "ok", 10: "warn", 15: "warn", 25: "critical"}
+	for val, level := range levels {
+		if g.level(val) != level {
+			t.Errorf("level(%v) should be %v, not %v", val, level, g.level(val))
+		}
+	}
+
+	g.Below = true
+	g.Warn = 10
+	g.Critical = 5
+	levels = map[Countable]string{15: "ok", 10: "warn", 7: "warn", 1: "critical"}
+	for val, level := range levels {
+		if g.level(val) != level {
+			t.Errorf("level(%v) should be %v, not %v", val, level, g.level(val))
+		}
+	}
+}
+
+func TestGaugeDelta(t *testing.T) {
+	g := NewGauge()
+	start := time.Unix(1400000000, 0)
+	g.Add(start, 1, nil)
+	_, last := g.Changed(0)
+	g.Add(start.Add(time.Second), 2, nil)
+
+	delta, err := json.Marshal(g.Delta(last))
+	if err != nil {
+		t.Fatalf("Delta couldn't be marshaled: %v", err)
+	}
+	text := string(delta)
+	if strings.Contains(text, start.Format(time.RFC3339Nano)) {
+		t.Errorf("Delta included an unchanged value (%v)", text)
+	}
+	if !strings.Contains(text, `"Value":2`) || !strings.Contains(text, `"Partial":true`) {
+		t.Errorf("Delta didn't include the latest value (%v)", text)
+	}
+	if !strings.Contains(text, `"Warn":null`) {
+		t.Errorf("Delta didn't include the unset thresholds as null (%v)", text)
+	}
+
+	g.Critical = 5
+	data, _ := json.Marshal(g)
+	if !strings.Contains(string(data), `"Critical":5`) {
+		t.Errorf("Gauge wasn't marshaled with its thresholds (%s)", data)
+	}
+}
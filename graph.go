@@ -2,8 +2,13 @@ package graphblast
 
 import (
 	"bufio"
+	"encoding/json"
 	"io"
+	"math"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,10 +25,204 @@ func (r *Range) MarshalJSON() ([]byte, error) {
 	return []byte("null"), nil
 }
 
+// Graph is implemented by each type of graph. The int passed to Changed and
+// Delta is an indicator previously returned by Changed (or 0, meaning the
+// graph has never been sent). Read holds the graph's lock while it changes
+// the graph, and the graph must be locked while it's otherwise used.
 type Graph interface {
+	sync.Locker
 	Changed(int) (bool, int)
+	Delta(int) interface{}
 	Read(io.Reader) error
-	// TODO Make it possible to determine and send deltas
+}
+
+// Expirer is implemented by graphs that drop data as it gets older, rather
+// than only when new data arrives.
+type Expirer interface {
+	Expire(time.Time)
+}
+
+// Alerter is implemented by graphs that evaluate alert rules as data arrives.
+// Alerts returns the alert events since it was last called, and Deliver
+// queues one to notify anyone outside graphblast of, without waiting.
+type Alerter interface {
+	Alerts() []AlertEvent
+	Deliver(AlertEvent)
+}
+
+// Validator is implemented by graphs with options that may be invalid, such
+// as regexps, so that they can be rejected when the graph is configured rather
+// than as lines are read.
+type Validator interface {
+	Validate() error
+}
+
+// Validate returns an error if a graph is a Validator and its options are
+// invalid.
+func Validate(graph Graph) error {
+	if validator, ok := graph.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// changeLog records when keys in a graph's Values were updated or removed, so
+// that a graph can describe only what has changed since an indicator.
+type changeLog struct {
+	floor   int            // changes at or before floor have been forgotten
+	updated map[string]int // key -> indicator of its last update
+	removed map[string]int // key -> indicator of its removal
+}
+
+func newChangeLog() *changeLog {
+	return &changeLog{
+		updated: make(map[string]int),
+		removed: make(map[string]int)}
+}
+
+// Update records that the value for key changed at indicator.
+func (cl *changeLog) Update(key string, indicator int) {
+	delete(cl.removed, key)
+	cl.updated[key] = indicator
+}
+
+// Remove records that the value for key was dropped at indicator.
+func (cl *changeLog) Remove(key string, indicator int) {
+	delete(cl.updated, key)
+	cl.removed[key] = indicator
+}
+
+// Since returns the keys updated and removed after indicator, and forgets
+// about any earlier changes. If the changes since indicator have already been
+// forgotten, ok is false and the caller should send the whole graph instead.
+func (cl *changeLog) Since(indicator int) (updated, removed []string, ok bool) {
+	if indicator < cl.floor {
+		return nil, nil, false
+	}
+	cl.floor = indicator
+
+	updated = make([]string, 0, len(cl.updated))
+	for key, when := range cl.updated {
+		if when <= indicator {
+			delete(cl.updated, key)
+		} else {
+			updated = append(updated, key)
+		}
+	}
+	removed = make([]string, 0, len(cl.removed))
+	for key, when := range cl.removed {
+		if when <= indicator {
+			delete(cl.removed, key)
+		} else {
+			removed = append(removed, key)
+		}
+	}
+	return updated, removed, true
+}
+
+// delta is a partial update of a graph. It's marshaled as the graph is, but
+// with some fields (such as Values) holding only what has changed since an
+// indicator, along with the keys removed since then.
+type delta struct {
+	graph   interface{}
+	fields  map[string]interface{} // replacements for fields of the graph
+	removed []string
+}
+
+func newDelta(graph interface{}, removed []string) *delta {
+	return &delta{graph, make(map[string]interface{}), removed}
+}
+
+// Set replaces a field of the graph in the delta.
+func (d *delta) Set(field string, value interface{}) *delta {
+	d.fields[field] = value
+	return d
+}
+
+// MarshalJSON marshals the fields of the graph that aren't replaced one by
+// one, rather than marshaling the whole graph, since the fields replaced may
+// be large.
+func (d *delta) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{})
+	for name, value := range d.fields {
+		fields[name] = value
+	}
+	plainFields(reflect.ValueOf(d.graph).Elem(), fields)
+	fields["Removed"] = d.removed
+	if d.removed == nil {
+		fields["Removed"] = []string{}
+	}
+	fields["Partial"] = true
+	return json.Marshal(fields)
+}
+
+// plainFields adds the fields of a struct that encoding/json would marshal to
+// fields by name, unless they're already there, including the fields of
+// embedded structs (which fields of the struct itself take precedence over).
+// Numbers that can't be marshaled, such as NaN for unset thresholds, are
+// null.
+func plainFields(v reflect.Value, fields map[string]interface{}) {
+	var embedded []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		} else if field.Anonymous && tag == "" {
+			if value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				embedded = append(embedded, value)
+			}
+			continue
+		} else if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag != "" {
+			name = tag
+		}
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		if value.Kind() == reflect.Float64 {
+			if f := value.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+				fields[name] = nil
+				continue
+			}
+		}
+		// Marshaling a pointer to the field uses any MarshalJSON method
+		// with a pointer receiver, as marshaling the graph would.
+		fields[name] = value.Addr().Interface()
+	}
+	for _, value := range embedded {
+		plainFields(value, fields)
+	}
+}
+
+// keyedDelta returns a delta of a graph (a pointer to a struct) in which the
+// named map fields hold only the keys updated since indicator, according to
+// changes, or the graph itself if those changes are no longer known.
+func keyedDelta(graph interface{}, changes *changeLog, indicator int, fields ...string) interface{} {
+	updated, removed, ok := changes.Since(indicator)
+	if !ok {
+		return graph
+	}
+	d := newDelta(graph, removed)
+	for _, field := range fields {
+		values := reflect.ValueOf(graph).Elem().FieldByName(field)
+		picked := reflect.MakeMap(values.Type())
+		for _, key := range updated {
+			k := reflect.ValueOf(key)
+			if value := values.MapIndex(k); value.IsValid() {
+				picked.SetMapIndex(k, value)
+			}
+		}
+		d.Set(field, picked.Interface())
+	}
+	return d
 }
 
 // NewGraphFromType returns an unconfigured graph object for the type of graph
@@ -39,6 +238,18 @@ func NewGraphFromType(graphType string) Graph {
 		return NewScatterPlot()
 	case "histogram":
 		return NewHistogram()
+	case "rate":
+		return NewLineRate()
+	case "categories":
+		return NewCategories()
+	case "heatmap":
+		return NewHeatmap()
+	case "gauge":
+		return NewGauge()
+	case "table":
+		return NewTable()
+	case "boxplot":
+		return NewBoxPlot()
 	default:
 		return nil
 	}
@@ -78,24 +289,63 @@ func DumpGraphs(subscriber string) GraphRequest {
 	return func(graphs *Graphs, subs Subscribers) {
 		for name, graph := range graphs.named {
 			CreateGraph(name, graph)(graphs, subs)
-			subs.Send(NewJSONMessageTo([]string{subscriber}, name, graph))
+			graph.Lock()
+			message := NewJSONMessageTo([]string{subscriber}, name, graph)
+			graph.Unlock()
+			subs.Send(message)
 		}
 	}
 }
 
-// NotifyChanges sends all Graphs that have changed (since the last call to
-// NotifyChanges) to all subscribers.
+// NotifyChanges sends the changes to all Graphs that have changed (since the
+// last call to NotifyChanges) to all subscribers, first letting any Graphs
+// that expire old data do so, and sending (and delivering) any alerts. Graphs
+// that have never been sent are sent whole, since subscribers that connected
+// before they were created have nothing to apply changes to.
 func NotifyChanges() GraphRequest {
 	return func(graphs *Graphs, subs Subscribers) {
+		now := time.Now()
 		for name, graph := range graphs.named {
-			changed, indicator := graph.Changed(graphs.changed[name])
-			graphs.changed[name] = indicator
-			if !changed {
-				continue
-			}
-			subs.Send(NewJSONMessage(name, graph))
+			graph.Lock()
+			graphs.notify(name, graph, now, subs)
+			graph.Unlock()
+		}
+	}
+}
+
+// notify sends the changes to a locked graph for NotifyChanges.
+func (graphs *Graphs) notify(name string, graph Graph, now time.Time, subs Subscribers) {
+	if expirer, ok := graph.(Expirer); ok {
+		expirer.Expire(now)
+	}
+	if alerter, ok := graph.(Alerter); ok {
+		for _, event := range alerter.Alerts() {
+			event.Graph = name
+			subs.Send(NewJSONMessage("__alert", event))
+			alerter.Deliver(event)
 		}
 	}
+	last := graphs.changed[name]
+	changed, indicator := graph.Changed(last)
+	graphs.changed[name] = indicator
+	if !changed {
+		return
+	}
+
+	var message Message
+	if last == 0 {
+		message = NewJSONMessage(name, graph)
+	} else {
+		message = NewJSONMessage(name, graph.Delta(last))
+	}
+	if _, err := message.Contents(); err != nil {
+		// The changes can't be sent again, so the whole graph is sent
+		// the next time it changes instead.
+		Log("couldn't marshal graph %v: %v", name, err)
+		graphs.changed[name] = 0
+		return
+	}
+	subs.Send(message)
 }
 
 // ProcessGraphRequests maintains an internal collection of Graphs, listens for
@@ -130,26 +380,74 @@ func PopulateGraph(name string, graph Graph, input io.Reader, requests chan<- Gr
 // The type of the items to parse from stdin and count in the histogram.
 type Countable float64
 
-// Parses a countable value from a string, and returns a non-nil error if
-// parsing fails.
+// Parses a countable value from a string, which may have a unit suffix (see
+// ParseUnit), and returns a non-nil error if parsing fails.
 func Parse(str string) (Countable, error) {
-	d, err := strconv.ParseFloat(str, 64)
-	return Countable(d), err
+	return ParseUnit(str, "")
 }
 
 // Returns the bucket (as a string) of which the countable value should
 // increment the count, given the bucket size.
-func (d Countable) Bucket(size int) string {
+func (d Countable) Bucket(size float64) string {
 	if size <= 0 {
 		size = 1
 	}
-	if d < 0 {
-		d -= Countable(size)
+	lower, _ := d.LinearBounds(size)
+	return formatBound(lower, size)
+}
+
+// Returns the lower (inclusive) and upper (exclusive) bounds of the bucket
+// containing the countable value, given the bucket size.
+func (d Countable) LinearBounds(size float64) (Countable, Countable) {
+	if size <= 0 {
+		size = 1
+	}
+	// The small offset keeps values on a bucket boundary from landing in the
+	// bucket below due to rounding, and adding zero turns -0 into 0.
+	n := math.Floor(float64(d)/size+1e-9) + 0
+	return Countable(n * size), Countable((n + 1) * size)
+}
+
+// Returns the bounds of the logarithmic bucket containing the countable
+// value, where each power of base is divided into steps buckets. Negative
+// values are bucketed like their absolute values, and zero has a bucket of
+// its own.
+func (d Countable) LogBounds(base float64, steps int) (Countable, Countable) {
+	if steps <= 0 {
+		steps = 1
+	}
+	if d == 0 {
+		return 0, 0
+	} else if d < 0 {
+		lower, upper := (-d).LogBounds(base, steps)
+		return -upper, -lower
+	}
+
+	// The small offset keeps exact powers of base from landing in the bucket
+	// below due to rounding.
+	exp := math.Log(float64(d)) / math.Log(base) * float64(steps)
+	n := math.Floor(exp + 1e-9)
+	lower := math.Pow(base, n/float64(steps))
+	upper := math.Pow(base, (n+1)/float64(steps))
+	return Countable(lower), Countable(upper)
+}
+
+// formatBound formats a bucket bound with no more decimal places than the
+// bucket size has, to hide rounding errors.
+func formatBound(bound Countable, size float64) string {
+	decimals := 0
+	sizeStr := strconv.FormatFloat(size, 'f', -1, 64)
+	if dot := strings.Index(sizeStr, "."); dot >= 0 {
+		decimals = len(sizeStr) - dot - 1
 	}
-	return strconv.Itoa(int(d) / size * size)
+	return strconv.FormatFloat(float64(bound), 'f', decimals, 64)
 }
 
-func doRead(input io.Reader, process func(string)) error {
+// doRead calls process with each line of input, holding locker while it does,
+// so that the graph being read into isn't sent while it's being changed. The
+// lock is released even if process panics, so that a bad upload can't leave
+// the graph locked.
+func doRead(input io.Reader, locker sync.Locker, process func(string)) error {
 	Log("starting to read data")
 	reader := bufio.NewReader(input)
 	for {
@@ -158,6 +456,10 @@ func doRead(input io.Reader, process func(string)) error {
 			Log("finished reading data due to %v", err)
 			return err
 		}
-		process(line)
+		func() {
+			locker.Lock()
+			defer locker.Unlock()
+			process(line)
+		}()
 	}
 }
@@ -1,7 +1,14 @@
 package graphblast
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRangeContains(t *testing.T) {
@@ -88,3 +95,244 @@ func TestCountableBucket(t *testing.T) {
 		t.Error("bucket failed on negative float for bucket of size 5")
 	}
 }
+
+func TestChangeLogSince(t *testing.T) {
+	cl := newChangeLog()
+	cl.Update("a", 1)
+	cl.Update("b", 2)
+	cl.Remove("a", 3)
+
+	updated, removed, ok := cl.Since(0)
+	if !ok {
+		t.Fatal("Since failed for changes that are still known")
+	}
+	if len(updated) != 1 || updated[0] != "b" {
+		t.Errorf("Since returned wrong updates (%v)", updated)
+	}
+	if len(removed) != 1 || removed[0] != "a" {
+		t.Errorf("Since returned wrong removals (%v)", removed)
+	}
+
+	cl.Update("c", 4)
+	updated, removed, ok = cl.Since(3)
+	if !ok {
+		t.Fatal("Since failed for changes that are still known")
+	}
+	if len(updated) != 1 || updated[0] != "c" || len(removed) != 0 {
+		t.Errorf("Since returned changes from before the indicator")
+	}
+
+	_, _, ok = cl.Since(0)
+	if ok {
+		t.Error("Since succeeded for changes that were forgotten")
+	}
+}
+
+func TestCountableBucketFractional(t *testing.T) {
+	if Countable(0.37).Bucket(0.1) != "0.3" {
+		t.Error("bucket failed on small float for bucket of size 0.1")
+	}
+
+	if Countable(0.3).Bucket(0.1) != "0.3" {
+		t.Error("bucket failed on bucket boundary for bucket of size 0.1")
+	}
+
+	if Countable(-0.01).Bucket(0.25) != "-0.25" {
+		t.Error("bucket failed on negative float for bucket of size 0.25")
+	}
+}
+
+func TestCountableLinearBounds(t *testing.T) {
+	lower, upper := Countable(4.9).LinearBounds(5)
+	if lower != 0 || upper != 5 {
+		t.Errorf("linear bounds were wrong (%v, %v)", lower, upper)
+	}
+
+	lower, upper = Countable(-0.1).LinearBounds(5)
+	if lower != -5 || upper != 0 {
+		t.Errorf("linear bounds were wrong for negative (%v, %v)", lower, upper)
+	}
+}
+
+func TestCountableLogBounds(t *testing.T) {
+	lower, upper := Countable(250).LogBounds(10, 1)
+	if lower != 100 || upper != 1000 {
+		t.Errorf("log bounds were wrong (%v, %v)", lower, upper)
+	}
+
+	lower, upper = Countable(1000).LogBounds(10, 1)
+	if lower != 1000 {
+		t.Errorf("log bounds were wrong for a power of the base (%v, %v)", lower, upper)
+	}
+
+	lower, upper = Countable(0.003).LogBounds(10, 2)
+	if math.Abs(float64(lower)-0.001) > 1e-12 || math.Abs(float64(upper)-0.00316227766) > 1e-9 {
+		t.Errorf("log bounds were wrong with steps (%v, %v)", lower, upper)
+	}
+
+	lower, upper = Countable(-250).LogBounds(10, 1)
+	if lower != -1000 || upper != -100 {
+		t.Errorf("log bounds were wrong for negative (%v, %v)", lower, upper)
+	}
+
+	lower, upper = Countable(0).LogBounds(10, 1)
+	if lower != 0 || upper != 0 {
+		t.Errorf("log bounds were wrong for zero (%v, %v)", lower, upper)
+	}
+}
+
+type recordingSubscribers []Message
+
+func (rs *recordingSubscribers) Send(message Message) {
+	*rs = append(*rs, message)
+}
+
+func TestNotifyChangesNewGraph(t *testing.T) {
+	graphs := &Graphs{make(map[string]Graph), make(map[string]int)}
+	subs := &recordingSubscribers{}
+	NotifyChanges()(graphs, subs)
+
+	hist := NewHistogram()
+	CreateGraph("h", hist)(graphs, subs)
+	hist.Add(1, nil)
+	*subs = nil
+	NotifyChanges()(graphs, subs)
+	if len(*subs) != 1 {
+		t.Fatalf("NotifyChanges sent %v messages", len(*subs))
+	}
+	contents, _ := (*subs)[0].Contents()
+	if strings.Contains(string(contents), "Partial") {
+		t.Errorf("NotifyChanges sent part of a new graph (%s)", contents)
+	}
+
+	hist.Add(2, nil)
+	*subs = nil
+	NotifyChanges()(graphs, subs)
+	contents, _ = (*subs)[0].Contents()
+	if !strings.Contains(string(contents), `"Partial":true`) {
+		t.Errorf("NotifyChanges didn't send the changes to a graph (%s)", contents)
+	}
+}
+
+func TestKeyedDelta(t *testing.T) {
+	hist := NewHistogram()
+	hist.Add(1, nil)
+	_, indicator := hist.Changed(0)
+	hist.Add(2, nil)
+
+	delta, err := json.Marshal(keyedDelta(hist, hist.changes, indicator, "Values", "Bounds"))
+	if err != nil {
+		t.Fatalf("Delta could not be marshaled (%v)", err)
+	}
+	text := string(delta)
+	if !strings.Contains(text, `"Values":{"2":1}`) || !strings.Contains(text, `"Bounds":{"2":[2,3]}`) {
+		t.Errorf("Delta included the wrong values (%s)", text)
+	}
+	if !strings.Contains(text, `"Count":2`) || !strings.Contains(text, `"Partial":true`) {
+		t.Errorf("Delta didn't include the rest of the graph (%s)", text)
+	}
+	if keyedDelta(hist, hist.changes, 0, "Values") != hist {
+		t.Error("Delta didn't return the whole graph for old changes")
+	}
+}
+
+// countedValues counts the times they're marshaled.
+type countedValues struct {
+	marshaled int
+}
+
+func (cv *countedValues) MarshalJSON() ([]byte, error) {
+	cv.marshaled += 1
+	return []byte("{}"), nil
+}
+
+func TestDeltaMarshalReplaced(t *testing.T) {
+	graph := &struct {
+		Values    countedValues
+		Threshold float64
+		Allowed   Range
+	}{Threshold: math.NaN()}
+	d := newDelta(graph, nil).Set("Values", map[string]int{"a": 1})
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Delta could not be marshaled (%v)", err)
+	}
+	if graph.Values.marshaled != 0 {
+		t.Error("Delta marshaled a field it replaced")
+	}
+	expected := `{"Allowed":null,"Partial":true,"Removed":[],"Threshold":null,"Values":{"a":1}}`
+	if string(data) != expected {
+		t.Errorf("Delta was marshaled wrongly (%s)", data)
+	}
+	if d.removed != nil {
+		t.Error("Marshaling a delta changed it")
+	}
+}
+
+func TestNotifyChangesWhileReading(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxAge = time.Millisecond
+	graphs := &Graphs{map[string]Graph{"ts": ts}, make(map[string]int)}
+	reader, writer := io.Pipe()
+	done := make(chan bool)
+	go func() {
+		ts.Read(reader)
+		done <- true
+	}()
+
+	subs := &recordingSubscribers{}
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(writer, "%v\n", i)
+		NotifyChanges()(graphs, subs)
+	}
+	writer.Close()
+	<-done
+	if ts.Count != 200 {
+		t.Errorf("Read missed values while notifying (%v)", ts.Count)
+	}
+}
+
+func TestDoReadPanic(t *testing.T) {
+	var mu sync.Mutex
+	func() {
+		defer func() { recover() }()
+		doRead(strings.NewReader("1\n"), &mu, func(string) { panic("bad line") })
+	}()
+
+	locked := make(chan bool)
+	go func() {
+		mu.Lock()
+		locked <- true
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("doRead left the lock held after a panic")
+	}
+}
+
+// unmarshalableGraph always has changes, which can never be marshaled.
+type unmarshalableGraph struct {
+	sync.Mutex
+	Value float64
+}
+
+func (g *unmarshalableGraph) Changed(int) (bool, int) { return true, 1 }
+func (g *unmarshalableGraph) Delta(int) interface{}   { return g }
+func (g *unmarshalableGraph) Read(io.Reader) error    { return nil }
+
+func TestNotifyChangesUnmarshalable(t *testing.T) {
+	graphs := &Graphs{make(map[string]Graph), make(map[string]int)}
+	graphs.named["g"] = &unmarshalableGraph{Value: math.NaN()}
+	graphs.changed["g"] = 1
+	subs := &recordingSubscribers{}
+	NotifyChanges()(graphs, subs)
+
+	if len(*subs) != 0 {
+		t.Errorf("NotifyChanges sent a graph it couldn't marshal (%v)", *subs)
+	}
+	if graphs.changed["g"] != 0 {
+		t.Error("NotifyChanges didn't plan to send the whole graph again")
+	}
+}
@@ -2,19 +2,39 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/hut8labs/graphblast"
 	"math"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
+// stringsFlag is a flag that may be given more than once, collecting each
+// value.
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(val string) error {
+	*sf = append(*sf, val)
+	return nil
+}
+
 // Command-line flags.
 var listen = flag.String("listen", ":8080", "address:port to listen on")
 var verbose = flag.Bool("verbose", false, "be more verbose")
 var label = flag.String("label", "", "graph label")
 var min = flag.Float64("min", math.Inf(-1), "minimum accepted value")
 var max = flag.Float64("max", math.Inf(1), "maximum accepted value")
-var bucket = flag.Int("bucket", 1, "histogram bucket size")
+var minX = flag.Float64("min-x", math.Inf(-1), "minimum accepted x value")
+var maxX = flag.Float64("max-x", math.Inf(1), "maximum accepted x value")
+var bucket = flag.Float64("bucket", 1, "histogram bucket size")
+var logBase = flag.Float64("log-base", 0, "histogram logarithmic bucket base")
+var logSteps = flag.Int("log-steps", 1, "histogram buckets per power of base")
 var delay = flag.Int("delay", 5, "delay between updates, in seconds")
 var wide = flag.Bool("wide", false, "use wide orientation")
 var width = flag.Int("width", 500, "width of the graph, in pixels")
@@ -22,6 +42,70 @@ var height = flag.Int("height", 500, "height of the graph, in pixels")
 var colors = flag.String("colors", "", "comma-separated: bg, fg, bar color")
 var fontSize = flag.String("font-size", "", "font size (CSS)")
 var window = flag.Int("window", 1000, "data window size")
+var maxAge = flag.Duration("max-age", 0, "maximum age of data to retain")
+var seriesColumn = flag.Int("series-column", 0, "column naming each series")
+var timeColumn = flag.Int("time-column", 0, "column holding each timestamp")
+var timeField = flag.String("time-field", "", "JSON path to each timestamp")
+var timeFormat = flag.String("time-format", "rfc3339", "timestamp format")
+var quantiles = flag.String("quantiles", "", "comma-separated quantiles")
+var interval = flag.Duration("interval", 10*time.Second,
+	"quantile, line counting or heatmap column interval")
+var rollups = flag.String("rollups", "10s,1m,10m,1h", "rollup intervals")
+var top = flag.Int("top", 10, "number of most frequent categories to show")
+var capacity = flag.Int("capacity", 1000, "number of categories to count")
+var warn = flag.Float64("warn", math.NaN(), "gauge warning threshold")
+var critical = flag.Float64("critical", math.NaN(), "gauge critical threshold")
+var below = flag.Bool("below", false, "gauge thresholds are lower limits")
+var sample = flag.Bool("sample", false, "retain a random sample of points")
+var maxSeries = flag.Int("max-series", 20, "number of series or categories to retain")
+var maxGroups = flag.Int("max-groups", 20, "number of groups to retain")
+var groupField = flag.String("group-field", "", "field naming each group")
+var xField = flag.String("x-field", "", "field holding each x value")
+var include = flag.String("include", "", "regexp of log lines to retain")
+var exclude = flag.String("exclude", "", "regexp of log lines to drop")
+var highlight stringsFlag
+var fields = flag.String("fields", "", "comma-separated table columns")
+var smoothing = flag.String("smoothing", "", "sma:N or ewma:ALPHA smoothing")
+var alertAbove = flag.Float64("alert-above", math.NaN(), "alert above value")
+var alertBelow = flag.Float64("alert-below", math.NaN(), "alert below value")
+var alertPoints = flag.Int("alert-points", 1, "values to cross before alerting")
+var alertFor = flag.Duration("alert-for", 0, "time to cross before alerting")
+var alertCommand = flag.String("alert-command", "", "shell command for alerts")
+var alertWebhook = flag.String("alert-webhook", "", "URL to POST alerts to")
+var unit = flag.String("unit", "", "unit of values, such as ms, s, B or KiB")
+var unitX = flag.String("unit-x", "", "unit of x values, such as ms, s or B")
+var format = flag.String("format", "text", "input format: text, json or csv")
+var delimiter = flag.String("delimiter", "whitespace",
+	"field delimiter: whitespace, comma, tab, or any string")
+var field = flag.String("field", "", "field holding the value: index or name")
+var extract = flag.String("extract", "",
+	"regexp extracting the value: group named value, or first group")
+var rate = flag.Bool("rate", false, "plot the rate of increase of a counter")
+
+func init() {
+	flag.Var(&highlight, "highlight", "regexp to highlight in log lines")
+}
+
+func buildAlert() *graphblast.Alert {
+	alert := graphblast.NewAlert()
+	alert.AlertAbove = *alertAbove
+	alert.AlertBelow = *alertBelow
+	alert.AlertPoints = *alertPoints
+	alert.AlertFor = *alertFor
+	alert.AlertCommand = *alertCommand
+	alert.AlertWebhook = *alertWebhook
+	return alert
+}
+
+func buildInput() *graphblast.Input {
+	input := graphblast.NewInput()
+	input.Format = *format
+	input.Delimiter = *delimiter
+	input.Field = *field
+	input.Extract = *extract
+	input.Unit = *unit
+	return input
+}
 
 // TODO Convert this to use bind.GenerateFlags
 func buildGraph(arg string) graphblast.Graph {
@@ -32,9 +116,15 @@ func buildGraph(arg string) graphblast.Graph {
 	switch arg {
 	case "histogram":
 		graph := graphblast.NewHistogram()
+		graph.Input = buildInput()
 		graph.Label = *label
 		graph.Wide = *wide
 		graph.Bucket = *bucket
+		graph.LogBase = *logBase
+		graph.LogSteps = *logSteps
+		if *quantiles != "" {
+			graph.Quantiles = *quantiles
+		}
 		graph.Width = *width
 		graph.Height = *height
 		graph.Colors = *colors
@@ -43,8 +133,73 @@ func buildGraph(arg string) graphblast.Graph {
 		return graph
 	case "timeseries":
 		graph := graphblast.NewTimeSeries()
+		graph.Input = buildInput()
+		graph.Window = *window
+		graph.MaxAge = *maxAge
+		graph.MaxSeries = *maxSeries
+		graph.SeriesColumn = *seriesColumn
+		graph.TimeColumn = *timeColumn
+		graph.TimeField = *timeField
+		graph.TimeFormat = *timeFormat
+		graph.Quantiles = *quantiles
+		graph.Interval = *interval
+		graph.Rollups = *rollups
+		graph.Smoothing = *smoothing
+		graph.Rate = *rate
+		graph.Alert = buildAlert()
+		graph.Label = *label
+		graph.Width = *width
+		graph.Height = *height
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		graph.Allowed = allowed
+		return graph
+	case "rate":
+		graph := graphblast.NewLineRate()
+		graph.Alert = buildAlert()
+		graph.Window = *window
+		graph.MaxAge = *maxAge
+		graph.Interval = *interval
+		graph.Rollups = *rollups
+		graph.Label = *label
+		graph.Width = *width
+		graph.Height = *height
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		return graph
+	case "categories":
+		graph := graphblast.NewCategories()
+		graph.Label = *label
+		graph.Wide = *wide
+		graph.Top = *top
+		graph.Capacity = *capacity
+		graph.Width = *width
+		graph.Height = *height
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		return graph
+	case "heatmap":
+		graph := graphblast.NewHeatmap()
+		graph.Input = buildInput()
+		graph.Label = *label
+		graph.Bucket = *bucket
+		graph.Interval = *interval
 		graph.Window = *window
+		graph.Width = *width
+		graph.Height = *height
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		graph.Allowed = allowed
+		return graph
+	case "gauge":
+		graph := graphblast.NewGauge()
+		graph.Input = buildInput()
 		graph.Label = *label
+		graph.Window = *window
+		graph.Warn = *warn
+		graph.Critical = *critical
+		graph.Below = *below
+		graph.Alert = buildAlert()
 		graph.Width = *width
 		graph.Height = *height
 		graph.Colors = *colors
@@ -54,15 +209,51 @@ func buildGraph(arg string) graphblast.Graph {
 	case "scatterplot":
 		graph := graphblast.NewScatterPlot()
 		graph.Label = *label
+		graph.Window = *window
+		graph.Sample = *sample
+		graph.Input = buildInput()
+		graph.MaxSeries = *maxSeries
+		graph.UnitX = *unitX
+		graph.XField = *xField
+		graph.GroupField = *groupField
+		graph.AllowedX = graphblast.Range{
+			Min: graphblast.Countable(*minX),
+			Max: graphblast.Countable(*maxX)}
+		graph.Width = *width
+		graph.Height = *height
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		graph.Allowed = allowed
+		return graph
+	case "boxplot":
+		graph := graphblast.NewBoxPlot()
+		graph.Input = buildInput()
+		graph.Label = *label
+		graph.Window = *window
+		graph.MaxGroups = *maxGroups
+		graph.GroupField = *groupField
 		graph.Width = *width
 		graph.Height = *height
 		graph.Colors = *colors
 		graph.FontSize = *fontSize
 		graph.Allowed = allowed
 		return graph
+	case "table":
+		graph := graphblast.NewTable()
+		graph.Window = *window
+		graph.MaxAge = *maxAge
+		graph.Fields = *fields
+		graph.Label = *label
+		graph.Colors = *colors
+		graph.FontSize = *fontSize
+		return graph
 	case "logfile":
 		graph := graphblast.NewLogFile()
 		graph.Window = *window
+		graph.MaxAge = *maxAge
+		graph.Include = *include
+		graph.Exclude = *exclude
+		graph.Highlight = highlight
 		graph.Label = *label
 		graph.Colors = *colors
 		graph.FontSize = *fontSize
@@ -87,9 +278,13 @@ func main() {
 	// TODO Make graph-specific flags part of a subcommand/FlagSet
 	if flag.NArg() > 0 {
 		// Create a graph from stdin.
+		graph := buildGraph(flag.Arg(0))
+		if err := graphblast.Validate(graph); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 		go func() {
 			name := graphblast.DEFAULT_GRAPH_NAME
-			graph := buildGraph(flag.Arg(0))
 			graphblast.PopulateGraph(name, graph, os.Stdin, requests)
 		}()
 	}
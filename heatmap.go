@@ -0,0 +1,167 @@
+package graphblast
+
+import (
+	"container/list"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Heatmap buckets values into columns of time, counting the values in each
+// bucket of each column, over a rolling window of columns.
+type Heatmap struct {
+	sync.Mutex // held while the graph is read into or sent
+
+	*Input
+
+	Values   map[string]map[string]Countable // column -> bucket -> count
+	Bounds   map[string][]Countable          // the bounds of each bucket
+	columns  *list.List                      // of *point, ordered by time
+	changes  *changeLog
+	revision int       // incremented whenever values are added or dropped
+	newest   time.Time // the time of the newest value
+
+	Layout   string        // the layout to use (interpreted by JS)
+	Label    string        // the label of the graph
+	Width    int           // the maximum graph width in pixels
+	Height   int           // the maximum graph height in pixels
+	Bucket   float64       // the size of the value buckets
+	Interval time.Duration // the span of time of each column
+	Window   int           // the number of columns to retain, if > 0
+
+	Allowed Range
+
+	Colors   string // the colors to use when displaying the graph
+	FontSize string // the CSS font size to use when displaying the graph
+
+	Count    int // the number of values encountered so far
+	Filtered int // the number of values filtered out so far
+	Errors   int // the number of values skipped due to errors so far
+}
+
+func NewHeatmap() *Heatmap {
+	return &Heatmap{
+		Input:    NewInput(),
+		Layout:   "heatmap",
+		Values:   make(map[string]map[string]Countable),
+		Bounds:   make(map[string][]Countable),
+		columns:  list.New(),
+		changes:  newChangeLog(),
+		Bucket:   1,
+		Interval: 10 * time.Second,
+		Window:   60,
+		Allowed:  Range{Countable(math.Inf(-1)), Countable(math.Inf(1))}}
+}
+
+func (hm *Heatmap) Changed(indicator int) (bool, int) {
+	if hm.revision <= indicator {
+		return false, indicator
+	}
+	return true, hm.revision
+}
+
+// interval returns the span of time of each column.
+func (hm *Heatmap) interval() time.Duration {
+	if hm.Interval <= 0 {
+		return time.Second
+	}
+	return hm.Interval
+}
+
+// Add counts a value in its bucket of the column for a time.
+func (hm *Heatmap) Add(when time.Time, val Countable, err error) {
+	if err == errFiltered {
+		hm.Filtered += 1
+		return
+	} else if err != nil {
+		hm.Errors += 1
+		return
+	} else if !hm.Allowed.Contains(val) {
+		hm.Filtered += 1
+		return
+	}
+
+	if when.After(hm.newest) {
+		hm.newest = when
+	}
+	start := when.Truncate(hm.interval())
+	if start.Before(hm.cutoff(hm.newest)) {
+		hm.Filtered += 1
+		return
+	}
+
+	key := start.Format(time.RFC3339Nano)
+	column, ok := hm.Values[key]
+	if !ok {
+		column = make(map[string]Countable)
+		hm.Values[key] = column
+		insertPoint(hm.columns, &point{start, key})
+	}
+
+	bucket := val.Bucket(hm.Bucket)
+	if _, ok := hm.Bounds[bucket]; !ok {
+		lower, upper := val.LinearBounds(hm.Bucket)
+		hm.Bounds[bucket] = []Countable{lower, upper}
+	}
+	column[bucket] += 1
+
+	hm.Count += 1
+	hm.revision += 1
+	hm.changes.Update(key, hm.revision)
+	hm.Expire(hm.newest)
+}
+
+// cutoff returns the start of the oldest column in the window, as of now.
+func (hm *Heatmap) cutoff(now time.Time) time.Time {
+	if hm.Window <= 0 {
+		return time.Time{}
+	}
+	span := time.Duration(hm.Window-1) * hm.interval()
+	return now.Truncate(hm.interval()).Add(-span)
+}
+
+// Expire drops the columns that have fallen out of the window as of now.
+func (hm *Heatmap) Expire(now time.Time) {
+	cutoff := hm.cutoff(now)
+	dropped := 0
+	for hm.columns.Len() > 0 {
+		front := hm.columns.Front()
+		oldest := front.Value.(*point)
+		if !oldest.when.Before(cutoff) {
+			break
+		}
+		hm.columns.Remove(front)
+		delete(hm.Values, oldest.key)
+		hm.changes.Remove(oldest.key, hm.revision+1)
+		dropped += 1
+	}
+	if dropped > 0 {
+		hm.revision += 1
+	}
+}
+
+// Delta returns the columns that have changed since the indicator value was
+// returned by Changed, or the whole heatmap if they are no longer known.
+func (hm *Heatmap) Delta(indicator int) interface{} {
+	updated, removed, ok := hm.changes.Since(indicator)
+	if !ok {
+		return hm
+	}
+	values := make(map[string]map[string]Countable, len(updated))
+	bounds := make(map[string][]Countable)
+	for _, key := range updated {
+		values[key] = hm.Values[key]
+		for bucket := range hm.Values[key] {
+			bounds[bucket] = hm.Bounds[bucket]
+		}
+	}
+	return newDelta(hm, removed).Set("Values", values).Set("Bounds", bounds)
+}
+
+func (hm *Heatmap) Read(reader io.Reader) error {
+	return hm.read(reader, hm, func(value string, err error) {
+		val, err := hm.parse(value, err)
+		hm.Add(time.Now(), val, err)
+	})
+}
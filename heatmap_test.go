@@ -0,0 +1,90 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeatmapAdd(t *testing.T) {
+	hm := NewHeatmap()
+	hm.Bucket = 10
+	start := time.Unix(1400000000, 0)
+	key := start.Format(time.RFC3339Nano)
+
+	hm.Add(start, 12, nil)
+	hm.Add(start.Add(time.Second), 15, nil)
+	hm.Add(start.Add(2*time.Second), 21, nil)
+	if hm.Values[key]["10"] != 2 || hm.Values[key]["20"] != 1 {
+		t.Errorf("Add didn't count the values in buckets (%v)", hm.Values)
+	}
+	if b := hm.Bounds["20"]; len(b) != 2 || b[0] != 20 || b[1] != 30 {
+		t.Errorf("Add didn't record the bucket bounds (%v)", hm.Bounds)
+	}
+
+	hm.Add(start.Add(10*time.Second), 1, nil)
+	if len(hm.Values) != 2 {
+		t.Errorf("Add didn't start a new column (%v)", hm.Values)
+	}
+
+	hm.Add(start, 0, errors.New("fail"))
+	hm.Allowed = Range{0, 10}
+	hm.Add(start, 50, nil)
+	if hm.Count != 4 || hm.Errors != 1 || hm.Filtered != 1 {
+		t.Error("Add counted an error or a filtered value")
+	}
+}
+
+func TestHeatmapExpire(t *testing.T) {
+	hm := NewHeatmap()
+	hm.Interval = time.Second
+	hm.Window = 3
+	start := time.Unix(1400000000, 0)
+
+	hm.Add(start, 1, nil)
+	hm.Add(start.Add(time.Second), 1, nil)
+	hm.Add(start.Add(3*time.Second), 1, nil)
+	if len(hm.Values) != 2 {
+		t.Errorf("Add didn't drop a column outside the window (%v)", hm.Values)
+	}
+
+	hm.Add(start, 1, nil)
+	if hm.Filtered != 1 || len(hm.Values) != 2 {
+		t.Error("Add didn't filter a value outside the window")
+	}
+
+	_, last := hm.Changed(0)
+	hm.Expire(start.Add(time.Minute))
+	if len(hm.Values) != 0 {
+		t.Errorf("Expire didn't drop old columns (%v)", hm.Values)
+	}
+	if changed, _ := hm.Changed(last); !changed {
+		t.Error("Expire didn't mark the heatmap as changed")
+	}
+}
+
+func TestHeatmapDelta(t *testing.T) {
+	hm := NewHeatmap()
+	hm.Interval = time.Second
+	start := time.Unix(1400000000, 0)
+	hm.Add(start, 1, nil)
+	_, last := hm.Changed(0)
+	hm.Add(start.Add(time.Second), 2, nil)
+
+	delta, err := json.Marshal(hm.Delta(last))
+	if err != nil {
+		t.Fatalf("Delta couldn't be marshaled: %v", err)
+	}
+	text := string(delta)
+	if strings.Contains(text, start.Format(time.RFC3339Nano)) {
+		t.Errorf("Delta included an unchanged column (%v)", text)
+	}
+	if !strings.Contains(text, `"Bounds":{"2":[2,3]}`) {
+		t.Errorf("Delta didn't include the changed bounds (%v)", text)
+	}
+	if !strings.Contains(text, `"Partial":true`) {
+		t.Errorf("Delta wasn't marked partial (%v)", text)
+	}
+}
@@ -3,20 +3,29 @@ package graphblast
 import (
 	"io"
 	"math"
-	"strings"
+	"strconv"
+	"sync"
 )
 
 // Collects and buckets values. Stats (min, max, total, etc.) are computed as
 // countable values come in.
 type Histogram struct {
-	Values map[string]Countable
+	sync.Mutex // held while the graph is read into or sent
 
-	Layout string // the layout to use (interpreted by JS)
-	Bucket int    // the histogram bucket size
-	Label  string // the label of the histogram
-	Wide   bool   // whether to use the alternate wide graph orientation
-	Width  int    // the maximum graph width in pixels
-	Height int    // the maximum graph height in pixels
+	*Input
+
+	Values  map[string]Countable
+	Bounds  map[string][]Countable // the lower and upper bound of each bucket
+	changes *changeLog
+
+	Layout   string  // the layout to use (interpreted by JS)
+	Bucket   float64 // the histogram bucket size
+	LogBase  float64 // if greater than 1, the base for logarithmic buckets
+	LogSteps int     // the number of logarithmic buckets per power of LogBase
+	Label    string  // the label of the histogram
+	Wide     bool    // whether to use the alternate wide graph orientation
+	Width    int     // the maximum graph width in pixels
+	Height   int     // the maximum graph height in pixels
 
 	Allowed Range
 
@@ -30,17 +39,24 @@ type Histogram struct {
 	Count    int // the number of values encountered so far
 	Filtered int // the number of values filtered out so far
 	Errors   int // the number of values skipped due to errors so far
+
+	Quantiles string          // comma-separated quantiles to estimate
+	Estimates *QuantileSketch // the estimated quantiles of values so far
 }
 
 // Returns a new histogram.
 func NewHistogram() *Histogram {
 	return &Histogram{
-		Layout:  "histogram",
-		Values:  make(map[string]Countable, 1024),
-		Wide:    false,
-		Allowed: Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
-		Min:     Countable(math.Inf(1)),
-		Max:     Countable(math.Inf(-1))}
+		Input:     NewInput(),
+		Layout:    "histogram",
+		Values:    make(map[string]Countable, 1024),
+		Bounds:    make(map[string][]Countable, 1024),
+		changes:   newChangeLog(),
+		Wide:      false,
+		Quantiles: "p50,p90,p99",
+		Allowed:   Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
+		Min:       Countable(math.Inf(1)),
+		Max:       Countable(math.Inf(-1))}
 }
 
 // Returns whether the graph has changed since the `indicator` value was
@@ -54,7 +70,10 @@ func (hist *Histogram) Changed(indicator int) (bool, int) {
 
 // Adds a countable value, modifying the stats and counts accordingly.
 func (hist *Histogram) Add(val Countable, err error) {
-	if err != nil {
+	if err == errFiltered {
+		hist.Filtered += 1
+		return
+	} else if err != nil {
 		hist.Errors += 1
 		return
 	} else if !hist.Allowed.Contains(val) {
@@ -70,13 +89,45 @@ func (hist *Histogram) Add(val Countable, err error) {
 	}
 	hist.Sum += val
 	hist.Count += 1
-	hist.Values[val.Bucket(hist.Bucket)] += 1
+	if hist.Quantiles != "" {
+		if hist.Estimates == nil {
+			hist.Estimates = NewQuantileSketch(hist.Quantiles)
+		}
+		hist.Estimates.Add(val)
+	}
+	bucket := hist.bucket(val)
+	hist.Values[bucket] += 1
+	hist.changes.Update(bucket, hist.Count)
+}
+
+// Returns the bucket of which the countable value should increment the count,
+// recording the bounds of the bucket if it's new.
+func (hist *Histogram) bucket(val Countable) string {
+	var bucket string
+	var lower, upper Countable
+	if hist.LogBase > 1 {
+		lower, upper = val.LogBounds(hist.LogBase, hist.LogSteps)
+		bucket = strconv.FormatFloat(float64(lower), 'g', 6, 64)
+	} else {
+		bucket = val.Bucket(hist.Bucket)
+		lower, upper = val.LinearBounds(hist.Bucket)
+	}
+	if _, ok := hist.Bounds[bucket]; !ok {
+		hist.Bounds[bucket] = []Countable{lower, upper}
+	}
+	return bucket
+}
+
+// Returns the buckets that have changed since the `indicator` value was
+// returned, or the whole histogram if they are no longer known.
+func (hist *Histogram) Delta(indicator int) interface{} {
+	return keyedDelta(hist, hist.changes, indicator, "Values", "Bounds")
 }
 
 // Read and parse countable values from stdin, add them to a histogram and
 // update stats.
 func (hist *Histogram) Read(reader io.Reader) error {
-	return doRead(reader, func(line string) {
-		hist.Add(Parse(strings.TrimSpace(line)))
+	return hist.read(reader, hist, func(value string, err error) {
+		hist.Add(hist.parse(value, err))
 	})
 }
@@ -1,6 +1,7 @@
 package graphblast
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 	"testing"
@@ -110,3 +111,81 @@ func TestHistogramRead(t *testing.T) {
 		t.Error("Read failed to read the correct values")
 	}
 }
+
+func TestHistogramDelta(t *testing.T) {
+	hist := NewHistogram()
+	hist.Add(1, nil)
+	_, indicator := hist.Changed(0)
+	hist.Add(2, nil)
+	hist.Add(2, nil)
+
+	delta, err := json.Marshal(hist.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	if !strings.Contains(string(delta), `"Values":{"2":2}`) {
+		t.Errorf("Delta included the wrong buckets (%s)", delta)
+	}
+	if !strings.Contains(string(delta), `"Partial":true`) {
+		t.Errorf("Delta was not marked as partial (%s)", delta)
+	}
+	if !strings.Contains(string(delta), `"Count":3`) {
+		t.Errorf("Delta did not include the current stats (%s)", delta)
+	}
+
+	if hist.Delta(0) != hist {
+		t.Error("Delta did not return the whole histogram for old changes")
+	}
+}
+
+func TestHistogramEstimates(t *testing.T) {
+	hist := NewHistogram()
+	hist.Quantiles = "p50"
+	hist.Add(1, nil)
+	hist.Add(2, nil)
+	hist.Add(3, nil)
+	hist.Add(4, errors.New("fail"))
+
+	estimates := hist.Estimates.Estimates()
+	if len(estimates) != 1 || estimates[0].Value != 2 {
+		t.Errorf("histogram estimated the wrong quantiles (%v)", estimates)
+	}
+
+	hist = NewHistogram()
+	hist.Quantiles = ""
+	hist.Add(1, nil)
+	if hist.Estimates != nil {
+		t.Error("histogram estimated quantiles when none were requested")
+	}
+}
+
+func TestHistogramAddLogBuckets(t *testing.T) {
+	hist := NewHistogram()
+	hist.LogBase = 10
+	hist.Add(5, nil)
+	hist.Add(50, nil)
+	hist.Add(55, nil)
+
+	if len(hist.Values) != 2 || hist.Values["10"] != 2 {
+		t.Errorf("histogram recorded the wrong log buckets (%v)", hist.Values)
+	}
+	bounds := hist.Bounds["10"]
+	if len(bounds) != 2 || bounds[0] != 10 || bounds[1] != 100 {
+		t.Errorf("histogram recorded the wrong bounds (%v)", hist.Bounds)
+	}
+}
+
+func TestHistogramAddFractionalBuckets(t *testing.T) {
+	hist := NewHistogram()
+	hist.Bucket = 0.5
+	hist.Add(0.1, nil)
+	hist.Add(0.7, nil)
+
+	if hist.Values["0.0"] != 1 || hist.Values["0.5"] != 1 {
+		t.Errorf("histogram recorded the wrong buckets (%v)", hist.Values)
+	}
+	bounds := hist.Bounds["0.5"]
+	if len(bounds) != 2 || bounds[0] != 0.5 || bounds[1] != 1 {
+		t.Errorf("histogram recorded the wrong bounds (%v)", hist.Bounds)
+	}
+}
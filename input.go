@@ -0,0 +1,324 @@
+package graphblast
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errSkipped is returned for lines of input that hold no value to graph, such
+// as header lines.
+var errSkipped = errors.New("line skipped")
+
+// errFiltered is returned for lines of input that don't match the extraction
+// regexp, which graphs count as filtered rather than as errors.
+var errFiltered = errors.New("line filtered")
+
+// Input selects the value to graph from each line of input.
+type Input struct {
+	// The format of each line: "text" (the default), "json" for an object
+	// per line, or "csv" for comma-separated values under a header line.
+	Format string
+
+	// The separator between fields: "whitespace" (the default), "comma",
+	// "tab", or any other string. CSV fields are separated by commas, unless
+	// it's "tab" or another single character.
+	Delimiter string
+
+	// The field holding the value, either a number (from 1) or a name given
+	// by a header line, or "" for the whole line (or the first field of CSV).
+	// For JSON, it's a dotted path to the value, such as "response.latency".
+	Field string
+
+	// A regexp to extract the value from the field (or line), using the group
+	// named "value", or else the first group, or else the whole match.
+	Extract string
+
+	// The unit of the values: a unit of time ("ms", "s", ...) or bytes ("B",
+	// "KiB", ...) to convert values with suffixes to, or any other label.
+	Unit string
+
+	header  map[string]int // the index of each field named in the header line
+	names   []string       // the names of the fields in the header line
+	pattern *regexp.Regexp // compiled from Extract by Validate
+	group   int            // the group of pattern holding the value
+	reader  *csv.Reader    // reads CSV records from source
+	source  *lineSource    // the line being read as CSV
+}
+
+// lineSource supplies lines to a csv.Reader one at a time, as they're read.
+type lineSource struct {
+	line string
+}
+
+func (ls *lineSource) Read(p []byte) (int, error) {
+	if ls.line == "" {
+		return 0, io.EOF
+	}
+	n := copy(p, ls.line)
+	ls.line = ls.line[n:]
+	return n, nil
+}
+
+func NewInput() *Input {
+	return &Input{Format: "text", Delimiter: "whitespace"}
+}
+
+// json returns whether each line is a JSON object.
+func (in *Input) json() bool {
+	return in.Format == "json"
+}
+
+// csv returns whether lines are comma-separated values under a header line.
+func (in *Input) csv() bool {
+	return in.Format == "csv"
+}
+
+// whitespace returns whether fields are separated by runs of whitespace.
+func (in *Input) whitespace() bool {
+	return !in.csv() && (in.Delimiter == "" || in.Delimiter == "whitespace")
+}
+
+// comma returns the separator between CSV fields, or an error if Delimiter
+// can't be one.
+func (in *Input) comma() (rune, error) {
+	switch in.Delimiter {
+	case "", "whitespace", "comma":
+		return ',', nil
+	case "tab":
+		return '\t', nil
+	}
+	runes := []rune(in.Delimiter)
+	if len(runes) != 1 || strings.ContainsRune("\r\n\"", runes[0]) {
+		return 0, fmt.Errorf("invalid CSV delimiter %q", in.Delimiter)
+	}
+	return runes[0], nil
+}
+
+// fields splits a line into fields. CSV fields may be quoted; a line that
+// isn't valid CSV has no fields.
+func (in *Input) fields(line string) []string {
+	if in.csv() {
+		if in.reader == nil {
+			comma, err := in.comma()
+			if err != nil {
+				return nil
+			}
+			in.source = &lineSource{}
+			in.reader = csv.NewReader(in.source)
+			in.reader.Comma = comma
+			in.reader.FieldsPerRecord = -1
+		}
+		in.source.line = line + "\n"
+		fields, err := in.reader.Read()
+		in.source.line = ""
+		if err != nil {
+			return nil
+		}
+		return fields
+	}
+
+	var fields []string
+	switch in.Delimiter {
+	case "", "whitespace":
+		return strings.Fields(line)
+	case "comma":
+		fields = strings.Split(line, ",")
+	case "tab":
+		fields = strings.Split(line, "\t")
+	default:
+		fields = strings.Split(line, in.Delimiter)
+	}
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+	}
+	return fields
+}
+
+// readHeader takes the fields of the first line to be the names of the
+// fields, returning whether it did. Lines with no fields are never taken to
+// be the header.
+func (in *Input) readHeader(fields []string) bool {
+	if in.header != nil || len(fields) == 0 {
+		return false
+	}
+	in.header = make(map[string]int, len(fields))
+	in.names = fields
+	for i, name := range fields {
+		in.header[name] = i
+	}
+	return true
+}
+
+// index returns the index of Field in the fields of a line. If the input is
+// CSV or Field is a name, the first line is taken to be a header naming the
+// fields, and errSkipped is returned for it.
+func (in *Input) index(fields []string) (int, error) {
+	return in.indexOf(fields, in.Field)
+}
+
+// indexOf returns the index of a field, named or numbered as Field is, in the
+// fields of a line, as index does for Field.
+func (in *Input) indexOf(fields []string, field string) (int, error) {
+	n, err := strconv.Atoi(field)
+	named := err != nil && field != ""
+	if (named || in.csv()) && in.readHeader(fields) {
+		return 0, errSkipped
+	}
+
+	if field == "" {
+		n = 1
+	}
+	if !named {
+		if n < 1 || n > len(fields) {
+			return 0, errors.New("missing field")
+		}
+		return n - 1, nil
+	}
+	i, ok := in.header[field]
+	if !ok || i >= len(fields) {
+		return 0, errors.New("missing field")
+	}
+	return i, nil
+}
+
+// Value returns the text of the value in a line.
+func (in *Input) Value(line string) (string, error) {
+	if in.json() {
+		row, err := ParseRow(line)
+		if err != nil {
+			return "", err
+		}
+		value, err := Lookup(row, in.Field)
+		if err != nil {
+			return "", err
+		}
+		return in.extract(value)
+	} else if in.Field == "" && !in.csv() {
+		return in.extract(line)
+	}
+	fields := in.fields(line)
+	i, err := in.index(fields)
+	if err != nil {
+		return "", err
+	}
+	return in.extract(fields[i])
+}
+
+// column returns the text of another field of a line, named or numbered as
+// Field is (or a dotted path for JSON), such as one naming a group.
+func (in *Input) column(line string, field string) (string, error) {
+	if in.json() {
+		row, err := ParseRow(line)
+		if err != nil {
+			return "", err
+		}
+		return Lookup(row, field)
+	}
+	fields := in.fields(line)
+	i, err := in.indexOf(fields, field)
+	if err != nil {
+		return "", err
+	}
+	return fields[i], nil
+}
+
+// Lookup returns the text of the value at a dotted path in a JSON object,
+// such as "request.headers.host". Elements of arrays are selected by index.
+func Lookup(row Row, path string) (string, error) {
+	var value interface{} = map[string]interface{}(row)
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", errors.New("missing field")
+			}
+			value = v[i]
+		default:
+			value = nil
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", errors.New("missing field")
+	default:
+		return "", errors.New("field is not a number or string")
+	}
+}
+
+// Validate compiles Extract, returning an error if it or the delimiter of CSV
+// fields is invalid.
+func (in *Input) Validate() error {
+	if in.csv() {
+		if _, err := in.comma(); err != nil {
+			return err
+		}
+	}
+	if in.Extract == "" || in.pattern != nil {
+		return nil
+	}
+	pattern, err := regexp.Compile(in.Extract)
+	if err != nil {
+		return fmt.Errorf("invalid extract regexp %q: %v", in.Extract, err)
+	}
+	in.pattern = pattern
+	if pattern.NumSubexp() > 0 {
+		in.group = 1
+	}
+	for i, name := range pattern.SubexpNames() {
+		if name == "value" {
+			in.group = i
+		}
+	}
+	return nil
+}
+
+// extract returns the text matched by Extract in a value, or errFiltered if
+// it doesn't match. Every value is an error if Extract is invalid.
+func (in *Input) extract(value string) (string, error) {
+	if in.Extract == "" {
+		return value, nil
+	}
+	if err := in.Validate(); err != nil {
+		return "", err
+	}
+	match := in.pattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", errFiltered
+	}
+	return match[in.group], nil
+}
+
+// parse parses the text of a value in Unit, unless there was an error finding
+// it.
+func (in *Input) parse(text string, err error) (Countable, error) {
+	if err != nil {
+		return 0, err
+	}
+	return ParseUnit(text, in.Unit)
+}
+
+// read reads lines of input, calling process with the value of each line (or
+// the error finding it) while holding locker, and skipping lines with no
+// value.
+func (in *Input) read(input io.Reader, locker sync.Locker, process func(string, error)) error {
+	return doRead(input, locker, func(line string) {
+		value, err := in.Value(strings.TrimSpace(line))
+		if err == errSkipped {
+			return
+		}
+		process(value, err)
+	})
+}
@@ -0,0 +1,213 @@
+package graphblast
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInputFields(t *testing.T) {
+	tests := []struct {
+		delimiter string
+		line      string
+		expected  []string
+	}{
+		{"whitespace", " a  b\tc ", []string{"a", "b", "c"}},
+		{"comma", "a b, c,", []string{"a b", "c", ""}},
+		{"tab", "a b\t c", []string{"a b", "c"}},
+		{"|", "a|b", []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		in := NewInput()
+		in.Delimiter = test.delimiter
+		fields := in.fields(test.line)
+		if strings.Join(fields, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("fields with %q returned %q", test.delimiter, fields)
+		}
+	}
+}
+
+func TestInputValue(t *testing.T) {
+	in := NewInput()
+	if value, err := in.Value("1 2 3"); err != nil || value != "1 2 3" {
+		t.Error("Value didn't return the whole line with no field set")
+	}
+
+	in.Field = "2"
+	if value, err := in.Value("1 2 3"); err != nil || value != "2" {
+		t.Errorf("Value returned the wrong field (%v, %v)", value, err)
+	}
+	if _, err := in.Value("1"); err == nil {
+		t.Error("Value didn't fail for a missing field")
+	}
+}
+
+func TestInputValueNamed(t *testing.T) {
+	in := NewInput()
+	in.Delimiter = "comma"
+	in.Field = "latency"
+	if _, err := in.Value("path, latency"); err != errSkipped {
+		t.Error("Value didn't skip the header line")
+	}
+	if value, err := in.Value("/index, 12"); err != nil || value != "12" {
+		t.Errorf("Value returned the wrong field (%v, %v)", value, err)
+	}
+	if _, err := in.Value("/index"); err == nil {
+		t.Error("Value didn't fail for a missing field")
+	}
+}
+
+func TestHistogramReadField(t *testing.T) {
+	hist := NewHistogram()
+	hist.Delimiter = "tab"
+	hist.Field = "b"
+	hist.Read(strings.NewReader("a\tb\nx\t1\ny\t2\nz\n"))
+	if hist.Count != 2 || hist.Errors != 1 {
+		t.Errorf("Read didn't read the field (%v, %v)", hist.Count, hist.Errors)
+	}
+	if hist.Values["1"] != 1 || hist.Values["2"] != 1 {
+		t.Errorf("Read counted the wrong values (%v)", hist.Values)
+	}
+}
+
+func TestBindInput(t *testing.T) {
+	pattern := regexp.MustCompile("^/graph/(?P<type>\\w+)/(?P<name>\\w+)$")
+	u, _ := url.Parse("/graph/timeseries/test?delimiter=comma&field=3")
+	_, graph := ParseGraphURL(u, pattern)
+	ts, ok := graph.(*TimeSeries)
+	if !ok || ts.Delimiter != "comma" || ts.Field != "3" {
+		t.Errorf("ParseGraphURL didn't bind the input options (%v)", graph)
+	}
+}
+
+func TestParseGraphURLInvalidRegexp(t *testing.T) {
+	pattern := regexp.MustCompile("^/graph/(?P<type>\\w+)/(?P<name>\\w+)$")
+	for _, path := range []string{
+		"/graph/histogram/test?extract=(",
+		"/graph/logfile/test?include=(",
+		"/graph/logfile/test?highlight=ok&highlight=[",
+	} {
+		u, _ := url.Parse(path)
+		if _, graph := ParseGraphURL(u, pattern); graph != nil {
+			t.Errorf("ParseGraphURL accepted an invalid regexp (%v)", path)
+		}
+	}
+}
+
+func TestInputExtractInvalid(t *testing.T) {
+	in := NewInput()
+	in.Extract = "("
+	if in.Validate() == nil {
+		t.Error("Validate accepted an invalid regexp")
+	}
+	if _, err := in.Value("1"); err == nil {
+		t.Error("Value ignored an invalid regexp")
+	}
+}
+
+func TestInputExtract(t *testing.T) {
+	tests := []struct {
+		extract  string
+		expected string
+	}{
+		{`took (\d+)ms`, "123"},
+		{`status=(\d+) took (?P<value>\d+)`, "123"},
+		{`\d+ms`, "123ms"},
+	}
+	for _, test := range tests {
+		in := NewInput()
+		in.Extract = test.extract
+		value, err := in.Value("GET / status=200 took 123ms")
+		if err != nil || value != test.expected {
+			t.Errorf("Value with %q returned %q (%v)", test.extract, value, err)
+		}
+		if _, err := in.Value("GET / failed"); err != errFiltered {
+			t.Errorf("Value with %q didn't filter a line", test.extract)
+		}
+	}
+}
+
+func TestHistogramReadExtract(t *testing.T) {
+	hist := NewHistogram()
+	hist.Extract = `took (\S*)ms`
+	hist.Read(strings.NewReader("a took 12ms\nb failed\nc took 12ms\nd took ms\n"))
+	if hist.Count != 2 || hist.Filtered != 1 || hist.Errors != 1 {
+		t.Errorf("Read didn't extract values (%v, %v, %v)",
+			hist.Count, hist.Filtered, hist.Errors)
+	}
+	if hist.Values["12"] != 2 {
+		t.Errorf("Read counted the wrong values (%v)", hist.Values)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	row, _ := ParseRow(`{"a": {"b": [1, {"c": "x"}]}, "d": 1.5, "e": true}`)
+	tests := []struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		{"d", "1.5", true},
+		{"a.b.0", "1", true},
+		{"a.b.1.c", "x", true},
+		{"a.b.2", "", false},
+		{"a.x", "", false},
+		{"d.x", "", false},
+		{"e", "", false},
+		{"a", "", false},
+	}
+	for _, test := range tests {
+		value, err := Lookup(row, test.path)
+		if value != test.expected || (err == nil) != test.ok {
+			t.Errorf("Lookup of %q returned %q (%v)", test.path, value, err)
+		}
+	}
+}
+
+func TestGaugeReadJSON(t *testing.T) {
+	g := NewGauge()
+	g.Format = "json"
+	g.Field = "response.latency_ms"
+	g.Read(strings.NewReader(`{"response": {"latency_ms": 42}}
+not json
+{"response": {}}
+`))
+	if g.Count != 1 || g.Errors != 2 || g.Value != 42 {
+		t.Errorf("Read didn't read JSON (%v, %v, %v)", g.Count, g.Errors, g.Value)
+	}
+}
+
+func TestInputValueCSV(t *testing.T) {
+	in := NewInput()
+	in.Format = "csv"
+	if _, err := in.Value("a,b"); err != errSkipped {
+		t.Error("Value didn't skip the header line")
+	}
+	if value, err := in.Value(`"1,5",2`); err != nil || value != "1,5" {
+		t.Errorf("Value didn't return the first quoted field (%v, %v)", value, err)
+	}
+	in.Field = "b"
+	if value, err := in.Value("1,2"); err != nil || value != "2" {
+		t.Errorf("Value returned the wrong field (%v, %v)", value, err)
+	}
+}
+
+func TestInputValueCSVDelimiter(t *testing.T) {
+	in := NewInput()
+	in.Format = "csv"
+	in.Delimiter = ";"
+	in.Field = "b"
+	in.Value("a;b")
+	if _, err := in.Value(`1;"2`); err == nil {
+		t.Error("Value accepted invalid CSV")
+	}
+	if value, err := in.Value(`1,5;"2;5"`); err != nil || value != "2;5" {
+		t.Errorf("Value didn't use the delimiter (%v, %v)", value, err)
+	}
+
+	in.Delimiter = "::"
+	if in.Validate() == nil {
+		t.Error("Validate accepted a CSV delimiter of several characters")
+	}
+}
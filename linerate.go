@@ -0,0 +1,115 @@
+package graphblast
+
+import (
+	"io"
+	"time"
+)
+
+// LineRate counts lines as they're read, and plots the number per second
+// over each interval as a time series. It's useful when each line is an event
+// rather than a number. The rate of the interval being counted is published
+// as the graph expires old data (just before it's sent), rather than for
+// every line.
+type LineRate struct {
+	*TimeSeries
+
+	current   time.Time // the start of the interval being counted
+	lines     int       // the number of lines read during that interval
+	published int       // the number of those lines published so far
+}
+
+func NewLineRate() *LineRate {
+	return &LineRate{TimeSeries: NewTimeSeries()}
+}
+
+// interval returns the interval over which lines are counted.
+func (lr *LineRate) interval() time.Duration {
+	if lr.Interval <= 0 {
+		return time.Second
+	}
+	return lr.Interval
+}
+
+// Add counts a line read at a time.
+func (lr *LineRate) Add(when time.Time, err error) {
+	if err != nil {
+		lr.Errors += 1
+		return
+	}
+
+	start := when.Truncate(lr.interval())
+	if start.Before(lr.current) {
+		// The line belongs to an interval that's already been published.
+		lr.Filtered += 1
+		return
+	}
+	lr.advance(start)
+	lr.Count += 1
+	lr.lines += 1
+}
+
+// Expire publishes the rate of the interval being counted, and a zero rate
+// for the intervals that have passed since the last line was read, then drops
+// old values as the TimeSeries would.
+func (lr *LineRate) Expire(now time.Time) {
+	lr.advance(now.Truncate(lr.interval()))
+	lr.flush()
+	lr.TimeSeries.Expire(now)
+}
+
+// flush publishes the rate of the interval being counted, if it's changed.
+func (lr *LineRate) flush() {
+	if lr.lines != lr.published {
+		lr.publish(lr.current, lr.lines)
+		lr.published = lr.lines
+	}
+}
+
+// advance moves counting on to the interval beginning at start, publishing the
+// rate of the interval finished, and a zero rate for the new one and any
+// intervals skipped on the way. The rates of the intervals finished are
+// evaluated for alerts.
+func (lr *LineRate) advance(start time.Time) {
+	if !start.After(lr.current) {
+		return
+	}
+	if !lr.current.IsZero() {
+		lr.flush()
+		rate := Countable(lr.lines) / Countable(lr.interval().Seconds())
+		lr.observe("", lr.current, rate)
+	}
+
+	// There's no point filling in more intervals than the window will hold.
+	next := lr.current.Add(lr.interval())
+	skipped := int(start.Sub(next) / lr.interval())
+	if lr.current.IsZero() || (lr.Window > 0 && skipped >= lr.Window) {
+		next = start
+	}
+	for ; !next.After(start); next = next.Add(lr.interval()) {
+		lr.publish(next, 0)
+		if next.Before(start) {
+			lr.observe("", next, 0)
+		}
+	}
+	lr.current = start
+	lr.lines = 0
+	lr.published = 0
+}
+
+// publish records the rate for the interval beginning at start, given the
+// number of lines read during it.
+func (lr *LineRate) publish(start time.Time, lines int) {
+	ts := lr.TimeSeries
+	ts.revision += 1
+	if start.After(ts.newest) {
+		ts.newest = start
+	}
+	rate := Countable(lines) / Countable(lr.interval().Seconds())
+	ts.update(ts.unnamed, ts.series("").add(start, rate, ts.revision))
+}
+
+func (lr *LineRate) Read(reader io.Reader) error {
+	return doRead(reader, lr, func(line string) {
+		lr.Add(time.Now(), nil)
+	})
+}
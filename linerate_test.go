@@ -0,0 +1,90 @@
+package graphblast
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineRateAdd(t *testing.T) {
+	lr := NewLineRate()
+	lr.Interval = 10 * time.Second
+	start := time.Unix(1400000000, 0)
+	key := start.Format(time.RFC3339Nano)
+
+	lr.Add(start, nil)
+	lr.Add(start.Add(time.Second), nil)
+	if lr.Values[key] != 0 {
+		t.Errorf("Add published the rate of the interval being counted (%v)", lr.Values)
+	}
+	lr.Expire(start.Add(time.Second))
+	if lr.Values[key] != 0.2 {
+		t.Errorf("Add recorded the wrong rate (%v)", lr.Values)
+	}
+	if lr.Count != 2 {
+		t.Error("Add didn't count the lines")
+	}
+
+	later := start.Add(30 * time.Second)
+	lr.Add(later, nil)
+	lr.Expire(later)
+	if len(lr.Values) != 4 {
+		t.Errorf("Add didn't fill in the skipped intervals (%v)", lr.Values)
+	}
+	if lr.Values[start.Add(20*time.Second).Format(time.RFC3339Nano)] != 0 {
+		t.Error("Add recorded lines in a skipped interval")
+	}
+	if lr.Values[later.Format(time.RFC3339Nano)] != 0.1 {
+		t.Error("Add recorded the wrong rate after skipping intervals")
+	}
+
+	lr.Add(start, nil)
+	if lr.Filtered != 1 || lr.Values[key] != 0.2 {
+		t.Error("Add counted a line in an interval already published")
+	}
+
+	lr.Add(later, errors.New("fail"))
+	if lr.Errors != 1 || lr.Count != 3 {
+		t.Error("Add with error didn't increment the error count")
+	}
+}
+
+func TestLineRateExpire(t *testing.T) {
+	lr := NewLineRate()
+	lr.Interval = time.Second
+	lr.Window = 5
+	start := time.Unix(1400000000, 0)
+
+	lr.Add(start, nil)
+	lr.Expire(start.Add(2 * time.Second))
+	if len(lr.Values) != 3 {
+		t.Errorf("Expire didn't publish the idle intervals (%v)", lr.Values)
+	}
+
+	// Intervals beyond the window aren't filled in.
+	lr.Expire(start.Add(time.Hour))
+	if len(lr.Values) != 4 {
+		t.Errorf("Expire filled in intervals beyond the window (%v)", lr.Values)
+	}
+	if lr.Values[start.Add(time.Hour).Format(time.RFC3339Nano)] != 0 {
+		t.Error("Expire didn't publish the current interval")
+	}
+}
+
+func TestLineRateRead(t *testing.T) {
+	lr := NewLineRate()
+	lr.Read(strings.NewReader("a\nb\nc\n"))
+	if lr.Count != 3 {
+		t.Errorf("Read didn't count each line (%v)", lr.Count)
+	}
+	lr.Expire(time.Now())
+	total := Countable(0)
+	for _, rate := range lr.Values {
+		total += rate
+	}
+	if math.Abs(float64(total)-0.3) > 1e-9 {
+		t.Errorf("Read recorded the wrong rate (%v)", lr.Values)
+	}
+}
@@ -1,17 +1,45 @@
 package graphblast
 
 import (
+	"container/list"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
 )
 
+// A Span marks part of a line matched by a highlight rule: its start and end
+// (in UTF-16 code units, as JS indexes strings) and the index of the rule.
+type Span [3]int
+
+// logPatterns are the compiled regexps of a LogFile.
+type logPatterns struct {
+	include   *regexp.Regexp
+	exclude   *regexp.Regexp
+	highlight []*regexp.Regexp
+}
+
 type LogFile struct {
-	Values map[string]string
+	sync.Mutex // held while the graph is read into or sent
+
+	Values     map[string]string
+	Highlights map[string][]Span // the highlighted spans of each line
+	times      *list.List        // of *point, in the order lines were added
+	patterns   *logPatterns      // compiled by Validate
+	changes    *changeLog
+	revision   int // incremented whenever lines are added or dropped
+
+	Layout string        // the layout to use (interpreted by JS)
+	Label  string        // the label of the display
+	Window int           // the number of lines to retain, if > 0
+	MaxAge time.Duration // the age of the oldest lines to retain, if > 0
 
-	Layout string // the layout to use (interpreted by JS)
-	Label  string // the label of the display
-	Window int    // the number of lines to retain
+	Include   string   // a regexp that lines must match to be retained
+	Exclude   string   // a regexp that lines must not match to be retained
+	Highlight []string // regexps whose matches are highlighted
 
 	Colors   string // the colors to use when displaying the graph
 	FontSize string // the CSS font size to use when displaying the graph
@@ -23,16 +51,19 @@ type LogFile struct {
 
 func NewLogFile() *LogFile {
 	return &LogFile{
-		Layout: "logfile",
-		Window: 100,
-		Values: make(map[string]string, 1024)}
+		Layout:     "logfile",
+		Window:     100,
+		Values:     make(map[string]string, 1024),
+		Highlights: make(map[string][]Span),
+		times:      list.New(),
+		changes:    newChangeLog()}
 }
 
 func (lf *LogFile) Changed(indicator int) (bool, int) {
-	if lf.Count <= indicator {
+	if lf.revision <= indicator {
 		return false, indicator
 	}
-	return true, lf.Count
+	return true, lf.revision
 }
 
 func (lf *LogFile) Add(line string, err error) {
@@ -41,15 +72,124 @@ func (lf *LogFile) Add(line string, err error) {
 		return
 	}
 
-	lf.Values[fmt.Sprintf("%v", lf.Count)] = line
+	if err := lf.Validate(); err != nil {
+		lf.Errors += 1
+		return
+	}
+	if !lf.patterns.retain(line) {
+		lf.Filtered += 1
+		return
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%v", lf.Count)
+	lf.Values[key] = line
+	if spans := lf.patterns.spans(line); len(spans) > 0 {
+		lf.Highlights[key] = spans
+	}
+	lf.times.PushBack(&point{now, key})
 	lf.Count += 1
-	if len(lf.Values) > lf.Window {
-		delete(lf.Values, fmt.Sprintf("%v", lf.Count-lf.Window-1))
+	lf.revision += 1
+	lf.changes.Update(key, lf.revision)
+	lf.Expire(now)
+}
+
+// Validate compiles the Include, Exclude and Highlight regexps, returning an
+// error if any of them are invalid. Every line is an error until they're all
+// valid.
+func (lf *LogFile) Validate() error {
+	if lf.patterns != nil {
+		return nil
+	}
+	var err error
+	compile := func(expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		compiled, compileErr := regexp.Compile(expr)
+		if compileErr != nil {
+			err = fmt.Errorf("invalid regexp %q: %v", expr, compileErr)
+		}
+		return compiled
+	}
+	patterns := &logPatterns{
+		include: compile(lf.Include),
+		exclude: compile(lf.Exclude)}
+	for _, expr := range lf.Highlight {
+		if compiled := compile(expr); compiled != nil {
+			patterns.highlight = append(patterns.highlight, compiled)
+		}
+	}
+	if err != nil {
+		return err
 	}
+	lf.patterns = patterns
+	return nil
+}
+
+// retain returns whether a line passes the include and exclude regexps.
+func (lp *logPatterns) retain(line string) bool {
+	if lp.include != nil && !lp.include.MatchString(line) {
+		return false
+	}
+	return lp.exclude == nil || !lp.exclude.MatchString(line)
+}
+
+// spans returns the spans of a line matched by each highlight regexp.
+func (lp *logPatterns) spans(line string) []Span {
+	spans := make([]Span, 0)
+	for rule, expr := range lp.highlight {
+		for _, match := range expr.FindAllStringIndex(line, -1) {
+			if match[0] == match[1] {
+				continue
+			}
+			start := utf16Length(line[:match[0]])
+			end := start + utf16Length(line[match[0]:match[1]])
+			spans = append(spans, Span{start, end, rule})
+		}
+	}
+	return spans
+}
+
+// utf16Length returns the length of a string in UTF-16 code units.
+func utf16Length(str string) int {
+	return len(utf16.Encode([]rune(str)))
+}
+
+// Expire drops the oldest lines beyond the window, and those that have become
+// older than MaxAge as of now.
+func (lf *LogFile) Expire(now time.Time) {
+	cutoff := time.Time{}
+	if lf.MaxAge > 0 {
+		cutoff = now.Add(-lf.MaxAge)
+	}
+
+	dropped := 0
+	for lf.times.Len() > 0 {
+		front := lf.times.Front()
+		oldest := front.Value.(*point)
+		if (lf.Window <= 0 || lf.times.Len() <= lf.Window) && !oldest.when.Before(cutoff) {
+			break
+		}
+		lf.times.Remove(front)
+		delete(lf.Values, oldest.key)
+		delete(lf.Highlights, oldest.key)
+		lf.changes.Remove(oldest.key, lf.revision+1)
+		dropped += 1
+	}
+	if dropped > 0 {
+		lf.revision += 1
+	}
+}
+
+// Delta returns the lines added and dropped since the indicator value was
+// returned by Changed, or the whole log if they are no longer known.
+func (lf *LogFile) Delta(indicator int) interface{} {
+	return keyedDelta(lf, lf.changes, indicator, "Values", "Highlights")
 }
 
 func (lf *LogFile) Read(reader io.Reader) error {
-	return doRead(reader, func(line string) {
+	return doRead(reader, lf, func(line string) {
 		lf.Add(strings.TrimSpace(line), nil)
 	})
 }
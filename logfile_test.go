@@ -1,9 +1,11 @@
 package graphblast
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogFileAdd(t *testing.T) {
@@ -91,3 +93,107 @@ func TestLogFileRead(t *testing.T) {
 		t.Error("Read failed to read the correct values")
 	}
 }
+
+func TestLogFileDelta(t *testing.T) {
+	lf := NewLogFile()
+	lf.Window = 1
+	lf.Add("line1", nil)
+	_, indicator := lf.Changed(0)
+	lf.Add("line2", nil)
+
+	delta, err := json.Marshal(lf.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	if !strings.Contains(string(delta), `"Values":{"1":"line2"}`) {
+		t.Errorf("Delta included the wrong lines (%s)", delta)
+	}
+	if !strings.Contains(string(delta), `"Removed":["0"]`) {
+		t.Errorf("Delta did not include the dropped line (%s)", delta)
+	}
+
+	if lf.Delta(0) != lf {
+		t.Error("Delta did not return the whole log for old changes")
+	}
+}
+
+func TestLogFileExpire(t *testing.T) {
+	lf := NewLogFile()
+	lf.MaxAge = time.Minute
+	lf.Add("line1", nil)
+	_, indicator := lf.Changed(0)
+
+	lf.Expire(time.Now())
+	if len(lf.Values) != 1 {
+		t.Error("Expire dropped a line newer than the max age")
+	}
+	changed, _ := lf.Changed(indicator)
+	if changed {
+		t.Error("Changed reported a change when nothing expired")
+	}
+
+	lf.Expire(time.Now().Add(time.Hour))
+	if len(lf.Values) != 0 {
+		t.Error("Expire did not drop a line older than the max age")
+	}
+	changed, _ = lf.Changed(indicator)
+	if !changed {
+		t.Error("Changed did not report expired lines as a change")
+	}
+}
+
+func TestLogFileAddFiltered(t *testing.T) {
+	lf := NewLogFile()
+	lf.Include = "GET|POST"
+	lf.Exclude = "health"
+	lf.Add("GET /index", nil)
+	lf.Add("GET /health", nil)
+	lf.Add("PUT /index", nil)
+	lf.Add("POST /form", nil)
+
+	if lf.Count != 2 || lf.Filtered != 2 {
+		t.Errorf("Add filtered the wrong lines (%v, %v)", lf.Count, lf.Filtered)
+	}
+	if lf.Values["0"] != "GET /index" || lf.Values["1"] != "POST /form" {
+		t.Errorf("Add stored the wrong lines (%v)", lf.Values)
+	}
+}
+
+func TestLogFileAddInvalidPattern(t *testing.T) {
+	lf := NewLogFile()
+	lf.Include = "("
+	if lf.Validate() == nil {
+		t.Error("Validate accepted an invalid regexp")
+	}
+	lf.Add("line1", nil)
+	if lf.Count != 0 || lf.Errors != 1 {
+		t.Error("Add retained a line despite an invalid regexp")
+	}
+}
+
+func TestLogFileAddHighlight(t *testing.T) {
+	lf := NewLogFile()
+	lf.Highlight = []string{"ERROR", "[0-9]+"}
+	lf.Add("é ERROR 500 ERROR", nil)
+	lf.Add("nothing here", nil)
+
+	spans := lf.Highlights["0"]
+	expected := []Span{{2, 7, 0}, {12, 17, 0}, {8, 11, 1}}
+	if len(spans) != len(expected) {
+		t.Fatalf("Add highlighted the wrong spans (%v)", spans)
+	}
+	for i, span := range expected {
+		if spans[i] != span {
+			t.Errorf("Add highlighted the wrong spans (%v)", spans)
+		}
+	}
+	if _, ok := lf.Highlights["1"]; ok {
+		t.Error("Add highlighted a line with no matches")
+	}
+
+	lf.Window = 1
+	lf.Expire(time.Now())
+	if len(lf.Highlights) != 0 {
+		t.Error("Expire didn't drop the highlights of dropped lines")
+	}
+}
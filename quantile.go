@@ -0,0 +1,207 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// centroid is a cluster of values in a digest, summarized by their mean.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type centroids []centroid
+
+func (cs centroids) Len() int           { return len(cs) }
+func (cs centroids) Less(i, j int) bool { return cs[i].mean < cs[j].mean }
+func (cs centroids) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+
+// digest is a t-digest: a fixed-size sketch of a stream of values, from which
+// quantiles can be estimated (most accurately near the extremes). See Dunning
+// and Ertl, "Computing Extremely Accurate Quantiles Using t-Digests".
+type digest struct {
+	compression float64   // larger is more accurate, but uses more memory
+	merged      centroids // sorted by mean, and sized by compression
+	unmerged    centroids // recently added values
+	count       float64
+	min         float64
+	max         float64
+}
+
+func newDigest(compression float64) *digest {
+	return &digest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1)}
+}
+
+// Add adds a value to the digest, occasionally compressing it.
+func (d *digest) Add(val float64) {
+	d.unmerged = append(d.unmerged, centroid{val, 1})
+	d.count += 1
+	d.min = math.Min(d.min, val)
+	d.max = math.Max(d.max, val)
+	if len(d.unmerged) > int(d.compression)*5 {
+		d.merged = d.compress()
+		d.unmerged = d.unmerged[:0]
+	}
+}
+
+// compress returns the merged and unmerged centroids of the digest combined,
+// with neighboring centroids merged as long as they stay small enough. The
+// digest itself is left untouched.
+func (d *digest) compress() centroids {
+	all := make(centroids, 0, len(d.merged)+len(d.unmerged))
+	all = append(all, d.merged...)
+	all = append(all, d.unmerged...)
+	if len(all) == 0 {
+		return all
+	}
+	sort.Sort(all)
+
+	// A centroid may grow as long as it spans no more than one unit on the
+	// scale function, which keeps centroids small near the extremes.
+	result := make(centroids, 0, int(d.compression))
+	current := all[0]
+	seen := 0.0
+	limit := d.scale(0) + 1
+	for _, next := range all[1:] {
+		weight := current.weight + next.weight
+		if d.scale((seen+weight)/d.count) <= limit {
+			current.mean += (next.mean - current.mean) * next.weight / weight
+			current.weight = weight
+		} else {
+			seen += current.weight
+			result = append(result, current)
+			current = next
+			limit = d.scale(seen/d.count) + 1
+		}
+	}
+	return append(result, current)
+}
+
+// scale maps quantile q onto the digest's scale function, on which each
+// centroid may span at most one unit.
+func (d *digest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
+
+// Quantile returns an estimate of the value at quantile q (between 0 and 1)
+// of the values added to the digest so far, or NaN if there are none.
+func (d *digest) Quantile(q float64) float64 {
+	return d.quantiles([]float64{q})[0]
+}
+
+// quantiles returns estimates of the values at each of the (sorted) qs.
+func (d *digest) quantiles(qs []float64) []float64 {
+	result := make([]float64, len(qs))
+	cs := d.compress()
+	if len(cs) == 0 {
+		for i := range result {
+			result[i] = math.NaN()
+		}
+		return result
+	}
+
+	// Each centroid is treated as though its values were centered on its
+	// mean, and estimates are interpolated between the neighboring centers
+	// (or the min and max at either end).
+	prevMean, prevCenter := d.min, 0.0
+	seen := 0.0
+	i := 0
+	for _, c := range cs {
+		center := seen + c.weight/2
+		for ; i < len(qs) && qs[i]*d.count < center; i++ {
+			result[i] = interpolate(qs[i]*d.count,
+				prevCenter, prevMean, center, c.mean)
+		}
+		prevMean, prevCenter = c.mean, center
+		seen += c.weight
+	}
+	for ; i < len(qs); i++ {
+		result[i] = interpolate(qs[i]*d.count,
+			prevCenter, prevMean, d.count, d.max)
+	}
+	return result
+}
+
+// interpolate returns the y value on the line between (x0, y0) and (x1, y1)
+// at x.
+func interpolate(x, x0, y0, x1, y1 float64) float64 {
+	if x1 <= x0 {
+		return y0
+	}
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}
+
+// An Estimate is the estimated value at a quantile of a stream of values.
+type Estimate struct {
+	Name  string // the name of the quantile, e.g. "p99"
+	Value Countable
+}
+
+// QuantileSketch estimates a set of quantiles over a stream of values. It is
+// marshaled to JSON as an object mapping each quantile's name to its value.
+type QuantileSketch struct {
+	digest    *digest
+	quantiles []float64
+	names     []string
+}
+
+// NewQuantileSketch returns a sketch for the comma-separated quantiles in
+// spec, each of which is either a fraction ("0.99") or a percentile ("p99").
+// Invalid quantiles are ignored.
+func NewQuantileSketch(spec string) *QuantileSketch {
+	qs := make([]float64, 0)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		percentile := strings.HasPrefix(part, "p")
+		q, err := strconv.ParseFloat(strings.TrimPrefix(part, "p"), 64)
+		if percentile {
+			q /= 100
+		}
+		if err != nil || q < 0 || q > 1 {
+			continue
+		}
+		qs = append(qs, q)
+	}
+	sort.Float64s(qs)
+
+	names := make([]string, len(qs))
+	for i, q := range qs {
+		names[i] = "p" + strconv.FormatFloat(q*100, 'g', 6, 64)
+	}
+	return &QuantileSketch{newDigest(100), qs, names}
+}
+
+// Add adds a value to the sketch.
+func (qs *QuantileSketch) Add(val Countable) {
+	qs.digest.Add(float64(val))
+}
+
+// Estimates returns the estimated value of each quantile in the sketch, or
+// nothing if no values have been added.
+func (qs *QuantileSketch) Estimates() []Estimate {
+	if qs.digest.count == 0 {
+		return []Estimate{}
+	}
+	values := qs.digest.quantiles(qs.quantiles)
+	result := make([]Estimate, len(values))
+	for i, val := range values {
+		result[i] = Estimate{qs.names[i], Countable(val)}
+	}
+	return result
+}
+
+func (qs *QuantileSketch) MarshalJSON() ([]byte, error) {
+	estimates := qs.Estimates()
+	result := make(map[string]Countable, len(estimates))
+	for _, estimate := range estimates {
+		result[estimate.Name] = estimate.Value
+	}
+	return json.Marshal(result)
+}
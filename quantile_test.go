@@ -0,0 +1,63 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestDigestQuantile(t *testing.T) {
+	d := newDigest(100)
+	if !math.IsNaN(d.Quantile(0.5)) {
+		t.Error("Quantile returned a value for an empty digest")
+	}
+
+	// Add values out of order, so that compression sees them unsorted.
+	for i := 0; i < 10000; i++ {
+		d.Add(float64((i * 7919) % 10000))
+	}
+	if len(d.merged) > 200 {
+		t.Errorf("digest was not compressed (%v centroids)", len(d.merged))
+	}
+
+	expected := map[float64]float64{0: 0, 0.5: 5000, 0.9: 9000, 0.99: 9900, 1: 9999}
+	for q, val := range expected {
+		estimate := d.Quantile(q)
+		if math.Abs(estimate-val) > 50 {
+			t.Errorf("Quantile(%v) was %v, expected about %v", q, estimate, val)
+		}
+	}
+}
+
+func TestNewQuantileSketch(t *testing.T) {
+	qs := NewQuantileSketch("p99, 0.5,bogus,1.5,p99.9")
+	if len(qs.quantiles) != 3 {
+		t.Fatalf("NewQuantileSketch parsed the wrong quantiles (%v)", qs.quantiles)
+	}
+	if qs.names[0] != "p50" || qs.names[1] != "p99" || qs.names[2] != "p99.9" {
+		t.Errorf("NewQuantileSketch named the quantiles wrong (%v)", qs.names)
+	}
+}
+
+func TestQuantileSketchEstimates(t *testing.T) {
+	qs := NewQuantileSketch("p50")
+	if len(qs.Estimates()) != 0 {
+		t.Error("Estimates returned estimates for an empty sketch")
+	}
+	marshaled, err := json.Marshal(qs)
+	if err != nil || string(marshaled) != "{}" {
+		t.Errorf("empty sketch marshaled wrong (%s, %v)", marshaled, err)
+	}
+
+	qs.Add(1)
+	qs.Add(2)
+	qs.Add(3)
+	estimates := qs.Estimates()
+	if len(estimates) != 1 || estimates[0].Name != "p50" || estimates[0].Value != 2 {
+		t.Errorf("Estimates returned the wrong estimates (%v)", estimates)
+	}
+	marshaled, err = json.Marshal(qs)
+	if err != nil || string(marshaled) != `{"p50":2}` {
+		t.Errorf("sketch marshaled wrong (%s, %v)", marshaled, err)
+	}
+}
@@ -0,0 +1,128 @@
+package graphblast
+
+import (
+	"container/list"
+	"math"
+	"strings"
+	"time"
+)
+
+// A Rollup summarizes the values of a series over an interval of time.
+type Rollup struct {
+	Min   Countable
+	Max   Countable
+	Avg   Countable
+	Count int
+	sum   Countable
+}
+
+func newRollup() *Rollup {
+	return &Rollup{
+		Min: Countable(math.Inf(1)),
+		Max: Countable(math.Inf(-1))}
+}
+
+// add includes a value in the rollup.
+func (r *Rollup) add(val Countable) {
+	r.Count += 1
+	r.replace(0, val)
+}
+
+// replace swaps a value already included in the rollup for another. The old
+// value can't be taken back out of Min and Max, so they may be wider than the
+// values in the rollup.
+func (r *Rollup) replace(old Countable, val Countable) {
+	if val < r.Min {
+		r.Min = val
+	}
+	if val > r.Max {
+		r.Max = val
+	}
+	r.sum += val - old
+	r.Avg = r.sum / Countable(r.Count)
+}
+
+// tier rolls the values of a series up into buckets of a fixed interval.
+type tier struct {
+	interval time.Duration
+	rollups  map[string]*Rollup
+	starts   *list.List // of *point, ordered by time
+	changes  *changeLog
+}
+
+// newTiers returns a tier for each of the comma-separated intervals in spec,
+// from finest to coarsest, ignoring invalid intervals.
+func newTiers(spec string) []*tier {
+	tiers := make([]*tier, 0)
+	for _, part := range strings.Split(spec, ",") {
+		interval, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || interval <= 0 {
+			continue
+		}
+		if len(tiers) > 0 && interval <= tiers[len(tiers)-1].interval {
+			continue
+		}
+		tiers = append(tiers, &tier{
+			interval: interval,
+			rollups:  make(map[string]*Rollup),
+			starts:   list.New(),
+			changes:  newChangeLog()})
+	}
+	return tiers
+}
+
+// add includes a value at a time in the rollup for its interval. If replaced
+// is true, the value replaces old, which was previously added at that time.
+func (t *tier) add(when time.Time, old Countable, replaced bool, val Countable, indicator int) {
+	start := when.Truncate(t.interval)
+	key := start.Format(time.RFC3339Nano)
+	rollup, exists := t.rollups[key]
+	if !exists {
+		rollup = newRollup()
+		t.rollups[key] = rollup
+		insertPoint(t.starts, &point{start, key})
+	}
+	if replaced && exists {
+		rollup.replace(old, val)
+	} else {
+		rollup.add(val)
+	}
+	t.changes.Update(key, indicator)
+}
+
+// evict drops the rollups for intervals that end at or before cutoff.
+func (t *tier) evict(cutoff time.Time, indicator int) {
+	for t.starts.Len() > 0 {
+		front := t.starts.Front()
+		oldest := front.Value.(*point)
+		if oldest.when.Add(t.interval).After(cutoff) {
+			break
+		}
+		t.starts.Remove(front)
+		delete(t.rollups, oldest.key)
+		t.changes.Remove(oldest.key, indicator)
+	}
+}
+
+// insertPoint adds a point to a list of points ordered by time, keeping it in
+// order, and returns its element. Points are expected to arrive mostly in
+// order, so the search starts from the back.
+func insertPoint(points *list.List, p *point) *list.Element {
+	for e := points.Back(); e != nil; e = e.Prev() {
+		if !e.Value.(*point).when.After(p.when) {
+			return points.InsertAfter(p, e)
+		}
+	}
+	return points.PushFront(p)
+}
+
+// findPoint returns the element of the point stored under key in a list of
+// points, or nil if there isn't one, searching from the back.
+func findPoint(points *list.List, key string) *list.Element {
+	for e := points.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*point).key == key {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package graphblast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupAdd(t *testing.T) {
+	r := newRollup()
+	r.add(1)
+	r.add(3)
+	if r.Min != 1 || r.Max != 3 || r.Avg != 2 || r.Count != 2 {
+		t.Errorf("rollup recorded the wrong stats (%+v)", r)
+	}
+
+	r.replace(3, 5)
+	if r.Max != 5 || r.Avg != 3 || r.Count != 2 {
+		t.Errorf("rollup replaced a value wrong (%+v)", r)
+	}
+}
+
+func TestNewTiers(t *testing.T) {
+	tiers := newTiers("10s, 1m,bogus,30s,1h")
+	if len(tiers) != 3 {
+		t.Fatalf("newTiers returned the wrong number of tiers (%v)", len(tiers))
+	}
+	if tiers[0].interval != 10*time.Second || tiers[2].interval != time.Hour {
+		t.Error("newTiers returned the wrong intervals")
+	}
+
+	if len(newTiers("")) != 0 {
+		t.Error("newTiers returned tiers for an empty spec")
+	}
+}
+
+func TestTierAdd(t *testing.T) {
+	tier := newTiers("1m")[0]
+	start := time.Unix(1400000040, 0)
+	tier.add(start, 0, false, 1, 1)
+	tier.add(start.Add(time.Second), 0, false, 3, 2)
+	tier.add(start.Add(time.Minute), 0, false, 5, 3)
+
+	if len(tier.rollups) != 2 {
+		t.Fatalf("tier recorded the wrong rollups (%v)", tier.rollups)
+	}
+	rollup := tier.rollups[start.Format(time.RFC3339Nano)]
+	if rollup == nil || rollup.Count != 2 || rollup.Avg != 2 {
+		t.Errorf("tier recorded the wrong rollup (%+v)", rollup)
+	}
+}
+
+func TestTierEvict(t *testing.T) {
+	tier := newTiers("1m")[0]
+	start := time.Unix(1400000040, 0)
+	tier.add(start, 0, false, 1, 1)
+	tier.add(start.Add(time.Minute), 0, false, 5, 2)
+
+	tier.evict(start.Add(30*time.Second), 3)
+	if len(tier.rollups) != 2 {
+		t.Error("tier dropped a rollup for an interval that hadn't ended")
+	}
+	tier.evict(start.Add(time.Minute), 3)
+	if len(tier.rollups) != 1 {
+		t.Error("tier did not drop a rollup for an interval that ended")
+	}
+}
@@ -2,27 +2,180 @@ package graphblast
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"math"
+	"math/rand"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// A Pair is the x and y values of a point in a ScatterPlot. It's marshaled to
+// JSON as an array of the two.
+type Pair [2]Countable
+
+// A Fit is the least-squares line through the points of a ScatterPlot, and
+// their correlation coefficient (or 0 if the y values are all the same).
+type Fit struct {
+	Slope       Countable
+	Intercept   Countable
+	Correlation Countable
+}
+
+// moments are the running means and co-moments (sums of products of the
+// differences from the means) from which a Fit is computed. They're updated
+// as in Welford's algorithm, rather than kept as sums of squares, which lose
+// all precision for values far from zero, such as timestamps.
+type moments struct {
+	n, x, y    float64 // the number of pairs and the means of x and y
+	xx, yy, xy float64 // the co-moments
+}
+
+// add includes a pair in the moments, or takes it back out if sign is -1.
+func (m *moments) add(pair Pair, sign float64) {
+	x, y := float64(pair[0]), float64(pair[1])
+	n := m.n + sign
+	if n <= 0 {
+		*m = moments{}
+		return
+	}
+	dx, dy := x-m.x, y-m.y
+	m.n = n
+	m.x += sign * dx / n
+	m.y += sign * dy / n
+	m.xx += sign * dx * (x - m.x)
+	m.yy += sign * dy * (y - m.y)
+	m.xy += sign * dx * (y - m.y)
+}
+
+// fit returns the least-squares fit of the pairs in the moments, or nil if
+// there isn't one (when there are fewer than two distinct x values).
+func (m *moments) fit() *Fit {
+	if m.n < 2 || m.xx <= 0 {
+		return nil
+	}
+	fit := &Fit{Slope: Countable(m.xy / m.xx)}
+	fit.Intercept = Countable(m.y - float64(fit.Slope)*m.x)
+	if m.yy > 0 {
+		fit.Correlation = Countable(m.xy / math.Sqrt(m.xx*m.yy))
+	}
+	return fit
+}
+
+// Points are the pairs retained by a ScatterPlot for one category.
+type Points struct {
+	Values  []Pair     // the points retained, in no particular order
+	Fit     *Fit       // the least-squares fit of the points retained
+	changes *changeLog // of indices into Values
+	moments moments    // of the points retained
+	count   int        // the number of points encountered
+	updated int        // the indicator of the latest point encountered
+}
+
+func newPoints() *Points {
+	return &Points{
+		Values:  make([]Pair, 0),
+		changes: newChangeLog()}
+}
+
+// add stores a pair, possibly in place of an earlier one, as chosen by index.
+func (ps *Points) add(pair Pair, window int, random *rand.Rand, indicator int) {
+	ps.count += 1
+	ps.updated = indicator
+	index := ps.index(window, random)
+	if index < 0 {
+		return
+	} else if index == len(ps.Values) {
+		ps.Values = append(ps.Values, pair)
+	} else {
+		ps.moments.add(ps.Values[index], -1)
+		ps.Values[index] = pair
+	}
+	ps.changes.Update(strconv.Itoa(index), indicator)
+	ps.moments.add(pair, 1)
+	ps.Fit = ps.moments.fit()
+}
+
+// index returns where in Values to store the latest point, which may replace
+// an earlier one once the window is full, or -1 if it shouldn't be retained.
+// If random is non-nil, points are sampled using Vitter's Algorithm R, so
+// that each point encountered is equally likely to be retained.
+func (ps *Points) index(window int, random *rand.Rand) int {
+	if window <= 0 || ps.count <= window {
+		return ps.count - 1
+	} else if random == nil {
+		return (ps.count - 1) % window
+	}
+	if index := random.Intn(ps.count); index < window {
+		return index
+	}
+	return -1
+}
+
+// pointsView is how Points are marshaled to JSON in a delta, with only the
+// pairs stored since the delta's indicator, keyed by their index in Values.
+type pointsView struct {
+	Values  map[string]Pair
+	Fit     *Fit
+	Partial bool
+}
+
+// delta returns the pairs stored since the indicator, or false if they are no
+// longer known.
+func (ps *Points) delta(indicator int) (*pointsView, bool) {
+	updated, _, ok := ps.changes.Since(indicator)
+	if !ok {
+		return nil, false
+	}
+	values := make(map[string]Pair, len(updated))
+	for _, key := range updated {
+		index, _ := strconv.Atoi(key)
+		values[key] = ps.Values[index]
+	}
+	return &pointsView{values, ps.Fit, true}, true
+}
+
+// ScatterPlot plots pairs of values, optionally in named categories. Pairs
+// with no category are stored in the embedded Points.
 type ScatterPlot struct {
-	Values map[string]Countable
+	sync.Mutex // held while the graph is read into or sent
+
+	*Input
+	*Points
+	Series  map[string]*Points // the pairs in each named category
+	random  *rand.Rand
+	dropped int // the indicator when a category was last dropped
 
 	Layout string // the layout to use (interpreted by JS)
 	Label  string // the label of the histogram
 	Width  int    // the maximum graph width in pixels
 	Height int    // the maximum graph height in pixels
+	Window int    // the number of points to retain per category, if > 0
+	Sample bool   // whether to retain a random sample, rather than the latest
 
-	Allowed Range
+	// The number of named categories to retain, if > 0. Once there are
+	// more, the least recently updated category is dropped.
+	MaxSeries int
+
+	Allowed  Range // the range of y values to accept
+	AllowedX Range // the range of x values to accept
+
+	UnitX  string // the unit of x values (see ParseUnit)
+	XField string // the field holding each x value, named as Field is
+
+	// The field naming each pair's category, named as Field is, or "" for
+	// the rest of a line that isn't the pair (unless the pair is found by
+	// Field or Extract, or isn't in text).
+	GroupField string
 
 	Colors   string // the colors to use when displaying the graph
 	FontSize string // the CSS font size to use when displaying the graph
 
-	Min Countable // the minimum value encountered so far
-	Max Countable // the maximum value encountered so far
+	Min  Countable // the minimum y value encountered so far
+	Max  Countable // the maximum y value encountered so far
+	MinX Countable // the minimum x value encountered so far
+	MaxX Countable // the maximum x value encountered so far
 
 	Count    int // the number of values encountered so far
 	Filtered int // the number of values filtered out so far
@@ -31,11 +184,19 @@ type ScatterPlot struct {
 
 func NewScatterPlot() *ScatterPlot {
 	return &ScatterPlot{
-		Layout:  "scatterplot",
-		Values:  make(map[string]Countable, 1024),
-		Allowed: Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
-		Min:     Countable(math.Inf(1)),
-		Max:     Countable(math.Inf(-1))}
+		Input:     NewInput(),
+		Points:    newPoints(),
+		Series:    make(map[string]*Points),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		Layout:    "scatterplot",
+		Window:    1000,
+		MaxSeries: 20,
+		Allowed:   Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
+		AllowedX:  Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
+		Min:       Countable(math.Inf(1)),
+		Max:       Countable(math.Inf(-1)),
+		MinX:      Countable(math.Inf(1)),
+		MaxX:      Countable(math.Inf(-1))}
 }
 
 func (sp *ScatterPlot) Changed(indicator int) (bool, int) {
@@ -45,11 +206,22 @@ func (sp *ScatterPlot) Changed(indicator int) (bool, int) {
 	return true, sp.Count
 }
 
+// Add adds a pair with no category.
 func (sp *ScatterPlot) Add(x Countable, val Countable, err error) {
-	if err != nil {
+	sp.AddTo("", x, val, err)
+}
+
+// AddTo adds a pair to the named category, or to no category if name is
+// empty.
+func (sp *ScatterPlot) AddTo(name string, x Countable, val Countable, err error) {
+	if err == errFiltered {
+		sp.Filtered += 1
+		return
+	} else if err != nil || math.IsInf(float64(x), 0) || math.IsInf(float64(val), 0) {
+		// Infinite values would leave nothing to fit or draw.
 		sp.Errors += 1
 		return
-	} else if !sp.Allowed.Contains(val) {
+	} else if !sp.Allowed.Contains(val) || !sp.AllowedX.Contains(x) {
 		sp.Filtered += 1
 		return
 	}
@@ -60,25 +232,137 @@ func (sp *ScatterPlot) Add(x Countable, val Countable, err error) {
 	if val > sp.Max {
 		sp.Max = val
 	}
+	if x < sp.MinX {
+		sp.MinX = x
+	}
+	if x > sp.MaxX {
+		sp.MaxX = x
+	}
 
 	sp.Count += 1
-	// TODO This is an ugly hack
-	sp.Values[fmt.Sprintf("%v|%v", x, sp.Count)] = val
+	var random *rand.Rand
+	if sp.Sample {
+		random = sp.random
+	}
+	sp.series(name).add(Pair{x, val}, sp.Window, random, sp.Count)
+}
+
+// series returns the points for the named category, creating them if needed.
+func (sp *ScatterPlot) series(name string) *Points {
+	if name == "" {
+		return sp.Points
+	}
+	series, ok := sp.Series[name]
+	if !ok {
+		if sp.MaxSeries > 0 && len(sp.Series) >= sp.MaxSeries {
+			sp.dropSeries()
+		}
+		series = newPoints()
+		sp.Series[name] = series
+	}
+	return series
+}
+
+// dropSeries drops the least recently updated category.
+func (sp *ScatterPlot) dropSeries() {
+	least := ""
+	for name, series := range sp.Series {
+		if least == "" || series.updated < sp.Series[least].updated {
+			least = name
+		}
+	}
+	delete(sp.Series, least)
+	sp.dropped = sp.Count
+}
+
+// Delta returns the points stored since the indicator value was returned by
+// Changed, keyed by their index in Values, or the whole scatterplot if they
+// are no longer known or a category has been dropped since.
+func (sp *ScatterPlot) Delta(indicator int) interface{} {
+	unnamed, ok := sp.Points.delta(indicator)
+	if !ok || indicator < sp.dropped {
+		return sp
+	}
+	series := make(map[string]*pointsView, len(sp.Series))
+	for name, s := range sp.Series {
+		view, ok := s.delta(indicator)
+		if !ok {
+			return sp
+		}
+		if len(view.Values) > 0 {
+			series[name] = view
+		}
+	}
+	return newDelta(sp, nil).Set("Values", unnamed.Values).
+		Set("Fit", unnamed.Fit).Set("Series", series)
 }
 
+// Read reads lines of pairs. Unless they're found by Field (or Extract),
+// XField and GroupField, or fields aren't separated by whitespace, the x and
+// y values are the first two fields of a line, and the rest of it, if any,
+// names the category of the pair. Other than in JSON, XField and Field
+// default to the first and second fields.
 func (sp *ScatterPlot) Read(reader io.Reader) error {
-	return doRead(reader, func(line string) {
-		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
-		if len(parts) != 2 {
-			sp.Add(0, 0, errors.New("invalid line"))
+	return doRead(reader, sp, func(line string) {
+		name, x, val, err := sp.splitLine(strings.TrimSpace(line))
+		if err == errSkipped {
+			return
+		} else if err != nil {
+			sp.Add(0, 0, err)
 			return
 		}
-		parsedX, err := Parse(parts[0])
+		parsedX, err := ParseUnit(x, sp.UnitX)
 		if err != nil {
 			sp.Add(0, 0, err)
 			return
 		}
-		parsedVal, err := Parse(parts[1])
-		sp.Add(parsedX, parsedVal, err)
+		parsedVal, err := sp.parse(val, nil)
+		sp.AddTo(name, parsedX, parsedVal, err)
 	})
 }
+
+// splitLine separates a line into the name of a category and the text of the
+// x and y values.
+func (sp *ScatterPlot) splitLine(line string) (string, string, string, error) {
+	found := sp.Field != "" || sp.XField != "" || sp.Extract != "" || sp.GroupField != ""
+	if !sp.json() && sp.whitespace() && !found {
+		var values [2]string
+		rest := line
+		for i := range values {
+			rest = strings.TrimLeft(rest, " \t")
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			values[i], rest = rest[:end], rest[end:]
+		}
+		if values[1] == "" {
+			return "", "", "", errors.New("invalid line")
+		}
+		return strings.TrimSpace(rest), values[0], values[1], nil
+	}
+
+	xField := sp.XField
+	if xField == "" && !sp.json() {
+		xField = "1"
+	}
+	var val string
+	var err error
+	if sp.Field == "" && !sp.json() && (sp.csv() || sp.Extract == "") {
+		val, err = sp.column(line, "2")
+		if err == nil {
+			val, err = sp.extract(val)
+		}
+	} else {
+		val, err = sp.Value(line)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	x, err := sp.column(line, xField)
+	if err != nil || sp.GroupField == "" {
+		return "", x, val, err
+	}
+	name, err := sp.column(line, sp.GroupField)
+	return name, x, val, err
+}
@@ -1,7 +1,9 @@
 package graphblast
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
 	"strings"
 	"testing"
 )
@@ -13,7 +15,7 @@ func TestScatterPlotAdd(t *testing.T) {
 	if len(sp.Values) != 1 {
 		t.Error("Add did not record pair")
 	}
-	if sp.Values["1|1"] != 1 {
+	if sp.Values[0] != (Pair{1, 1}) {
 		t.Error("Add recorded wrong pair")
 	}
 
@@ -21,7 +23,7 @@ func TestScatterPlotAdd(t *testing.T) {
 	if len(sp.Values) != 2 {
 		t.Error("Add did not record second pair")
 	}
-	if sp.Values["1|2"] != 2 {
+	if sp.Values[1] != (Pair{1, 2}) {
 		t.Error("Add recorded wrong second pair")
 	}
 }
@@ -59,11 +61,63 @@ func TestScatterPlotAddNoFilter(t *testing.T) {
 	if len(sp.Values) != 1 {
 		t.Error("Add did not record pair")
 	}
-	if sp.Values["-100|1"] != 0 {
+	if sp.Values[0] != (Pair{-100, 0}) {
 		t.Error("Add recorded wrong pair")
 	}
 }
 
+func TestScatterPlotAddWindow(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Window = 2
+	sp.Add(1, 1, nil)
+	sp.Add(2, 2, nil)
+	sp.Add(3, 3, nil)
+
+	if len(sp.Values) != 2 {
+		t.Errorf("Add retained too many pairs (%v)", sp.Values)
+	}
+	if sp.Values[0] != (Pair{3, 3}) || sp.Values[1] != (Pair{2, 2}) {
+		t.Errorf("Add didn't replace the oldest pair (%v)", sp.Values)
+	}
+}
+
+func TestScatterPlotAddSample(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Window = 10
+	sp.Sample = true
+	sp.random.Seed(1)
+	for i := 0; i < 1000; i++ {
+		sp.Add(Countable(i), Countable(i), nil)
+	}
+
+	if len(sp.Values) != 10 || sp.Count != 1000 {
+		t.Errorf("Add retained the wrong number of pairs (%v)", sp.Values)
+	}
+	late := 0
+	for _, pair := range sp.Values {
+		if pair[0] >= 500 {
+			late += 1
+		}
+	}
+	if late == 0 || late == 10 {
+		t.Errorf("Add didn't sample pairs evenly (%v)", sp.Values)
+	}
+}
+
+func TestScatterPlotMarshal(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Add(1, 2, nil)
+	sp.Add(3, 4, nil)
+
+	data, err := json.Marshal(sp)
+	if err != nil {
+		t.Fatal("ScatterPlot could not be marshaled")
+	}
+	if !strings.Contains(string(data), `"Values":[[1,2],[3,4]]`) {
+		t.Errorf("ScatterPlot wasn't marshaled as pairs (%s)", data)
+	}
+}
+
 func TestScatterPlotChanged(t *testing.T) {
 	sp := NewScatterPlot()
 	changed, next := sp.Changed(0)
@@ -95,7 +149,7 @@ func TestScatterPlotRead(t *testing.T) {
 	if sp.Errors != 0 {
 		t.Error("Read failed to read the input without errors")
 	}
-	if sp.Values["10|1"] != 100 || sp.Values["20|2"] != 200 {
+	if sp.Values[0] != (Pair{10, 100}) || sp.Values[1] != (Pair{20, 200}) {
 		t.Error("Read failed to read the correct values")
 	}
 
@@ -107,7 +161,7 @@ func TestScatterPlotRead(t *testing.T) {
 	if sp.Errors != 1 {
 		t.Error("Read failed to signal an error in the input")
 	}
-	if sp.Values["30|3"] != 300 {
+	if sp.Values[2] != (Pair{30, 300}) {
 		t.Error("Read failed to read the correct values")
 	}
 
@@ -117,3 +171,222 @@ func TestScatterPlotRead(t *testing.T) {
 		t.Error("Read failed to signal an error for bad values")
 	}
 }
+
+func TestScatterPlotDelta(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Add(1, 1, nil)
+	_, indicator := sp.Changed(0)
+	sp.Add(2, 2, nil)
+
+	delta, err := json.Marshal(sp.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	if !strings.Contains(string(delta), `"Values":{"1":[2,2]}`) {
+		t.Errorf("Delta included the wrong points (%s)", delta)
+	}
+
+	if sp.Delta(0) != sp {
+		t.Error("Delta did not return the whole scatterplot for old changes")
+	}
+}
+
+func TestScatterPlotAddFilteredX(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.AllowedX = Range{Countable(-1), Countable(1)}
+	sp.Add(-100, 0, nil)
+	sp.Add(1, 5, nil)
+
+	if len(sp.Values) != 1 || sp.Filtered != 1 {
+		t.Error("Add didn't filter pair by x")
+	}
+	if sp.MinX != 1 || sp.MaxX != 1 {
+		t.Errorf("Add didn't track the range of x (%v, %v)", sp.MinX, sp.MaxX)
+	}
+}
+
+func TestScatterPlotFit(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Add(1, 1, nil)
+	if sp.Fit != nil {
+		t.Error("Add fit a line through a single point")
+	}
+
+	sp.Add(2, 3, nil)
+	sp.Add(3, 5, nil)
+	if sp.Fit == nil || sp.Fit.Slope != 2 || sp.Fit.Intercept != -1 {
+		t.Errorf("Add fit the wrong line (%v)", sp.Fit)
+	}
+	if sp.Fit.Correlation != 1 {
+		t.Errorf("Add computed the wrong correlation (%v)", sp.Fit.Correlation)
+	}
+
+	// Points dropped from the window are dropped from the fit.
+	sp.Window = 3
+	sp.Add(4, 0, nil)
+	sp.Add(5, -2, nil)
+	sp.Add(6, -4, nil)
+	fit := sp.Fit
+	if math.Abs(float64(fit.Slope)+2) > 1e-9 || math.Abs(float64(fit.Intercept)-8) > 1e-9 || fit.Correlation != -1 {
+		t.Errorf("Add didn't refit the points retained (%v)", sp.Fit)
+	}
+}
+
+func TestScatterPlotFitTimestamps(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Window = 100
+	for i := 0; i < 1000; i++ {
+		sp.Add(Countable(1.4e9+i), Countable(2*i+1), nil)
+	}
+
+	fit := sp.Fit
+	if fit == nil || math.Abs(float64(fit.Slope)-2) > 1e-6 {
+		t.Fatalf("Add fit the wrong slope for timestamps (%v)", fit)
+	}
+	if math.Abs(float64(fit.Intercept)+2.8e9-1) > 1e-2 {
+		t.Errorf("Add fit the wrong intercept for timestamps (%v)", fit.Intercept)
+	}
+	if math.Abs(float64(fit.Correlation)-1) > 1e-6 {
+		t.Errorf("Add computed the wrong correlation for timestamps (%v)", fit.Correlation)
+	}
+}
+
+func TestScatterPlotAddTo(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Window = 1
+	sp.AddTo("a", 1, 1, nil)
+	sp.AddTo("b", 2, 2, nil)
+	sp.AddTo("", 3, 3, nil)
+
+	if len(sp.Series) != 2 || len(sp.Values) != 1 {
+		t.Errorf("AddTo didn't store pairs per category (%v)", sp.Series)
+	}
+	if sp.Series["a"].Values[0] != (Pair{1, 1}) || sp.Series["b"].Values[0] != (Pair{2, 2}) {
+		t.Error("AddTo stored the wrong pairs")
+	}
+	if sp.Count != 3 {
+		t.Error("AddTo didn't count pairs in every category")
+	}
+}
+
+func TestScatterPlotAddToMaxSeries(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.MaxSeries = 2
+	sp.AddTo("a", 1, 1, nil)
+	sp.AddTo("b", 2, 2, nil)
+	sp.AddTo("a", 3, 3, nil)
+	_, indicator := sp.Changed(0)
+	sp.AddTo("c", 4, 4, nil)
+
+	if _, ok := sp.Series["b"]; ok || len(sp.Series) != 2 {
+		t.Errorf("AddTo didn't drop the least recently updated category (%v)", sp.Series)
+	}
+	if sp.Delta(indicator) != sp {
+		t.Error("Delta didn't send the whole graph after dropping a category")
+	}
+	sp.AddTo("", 5, 5, nil)
+	if _, ok := sp.Series["a"]; !ok {
+		t.Error("AddTo dropped a category for a pair with no category")
+	}
+}
+
+func TestScatterPlotReadCategories(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Read(strings.NewReader("10 100 GET /a\n20 200\n"))
+
+	if sp.Errors != 0 {
+		t.Error("Read failed to read a category")
+	}
+	if s, ok := sp.Series["GET /a"]; !ok || s.Values[0] != (Pair{10, 100}) {
+		t.Errorf("Read stored the wrong category (%v)", sp.Series)
+	}
+	if sp.Values[0] != (Pair{20, 200}) {
+		t.Error("Read didn't store a pair with no category")
+	}
+}
+
+func TestScatterPlotReadSpaces(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Read(strings.NewReader("10  100   GET /a\n\t20\t200\n"))
+
+	if sp.Count != 2 || sp.Errors != 0 {
+		t.Errorf("Read failed to read the input (%v, %v)", sp.Count, sp.Errors)
+	}
+	if s := sp.Series["GET /a"]; s == nil || s.Values[0] != (Pair{10, 100}) {
+		t.Errorf("Read stored the wrong category (%v)", sp.Series)
+	}
+	if sp.Values[0] != (Pair{20, 200}) {
+		t.Error("Read failed to read tab-separated values")
+	}
+}
+
+func TestScatterPlotReadJSON(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Format = "json"
+	sp.XField = "size"
+	sp.Field = "took"
+	sp.GroupField = "path"
+	sp.Unit = "ms"
+	sp.Read(strings.NewReader(`{"path": "/a", "size": 10, "took": "1s"}` + "\n" + `{"size": 5}` + "\n"))
+
+	if sp.Count != 1 || sp.Errors != 1 {
+		t.Errorf("Read failed to read the input (%v, %v)", sp.Count, sp.Errors)
+	}
+	if s := sp.Series["/a"]; s == nil || s.Values[0] != (Pair{10, 1000}) {
+		t.Errorf("Read stored the wrong category (%v)", sp.Series)
+	}
+}
+
+func TestScatterPlotReadCSV(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Format = "csv"
+	sp.Delimiter = ";"
+	sp.XField = "size"
+	sp.Field = "took"
+	sp.Read(strings.NewReader("took;size\n100;10\n200;20\n"))
+
+	if sp.Count != 2 || sp.Errors != 0 {
+		t.Errorf("Read failed to read the input (%v, %v)", sp.Count, sp.Errors)
+	}
+	if sp.Values[0] != (Pair{10, 100}) || sp.Values[1] != (Pair{20, 200}) {
+		t.Errorf("Read failed to select the columns (%v)", sp.Values)
+	}
+}
+
+func TestScatterPlotReadExtract(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Extract = `took (\d+)`
+	sp.Read(strings.NewReader("10 took 100\n20 failed\n"))
+
+	if sp.Count != 1 || sp.Filtered != 1 {
+		t.Errorf("Read didn't extract the values (%v, %v)", sp.Count, sp.Filtered)
+	}
+	if sp.Values[0] != (Pair{10, 100}) {
+		t.Errorf("Read extracted the wrong values (%v)", sp.Values)
+	}
+}
+
+func TestScatterPlotAddInfinite(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.Read(strings.NewReader("1 1\ninf 1\n1 -inf\n"))
+
+	if sp.Count != 1 || sp.Errors != 2 {
+		t.Errorf("AddTo accepted infinite values (%v, %v)", sp.Count, sp.Errors)
+	}
+}
+
+func TestScatterPlotDeltaSeries(t *testing.T) {
+	sp := NewScatterPlot()
+	sp.AddTo("a", 1, 1, nil)
+	_, indicator := sp.Changed(0)
+	sp.AddTo("b", 2, 2, nil)
+
+	delta, err := json.Marshal(sp.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	text := string(delta)
+	if !strings.Contains(text, `"Series":{"b":{"Values":{"0":[2,2]},"Fit":null,"Partial":true}}`) {
+		t.Errorf("Delta included the wrong categories (%s)", text)
+	}
+}
@@ -0,0 +1,81 @@
+package graphblast
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+)
+
+// smoother computes a smoothed value for each point in a Series, either as
+// the simple moving average of the last few points or as an exponentially
+// weighted moving average.
+type smoother struct {
+	points int     // the number of points in a simple moving average
+	alpha  float64 // the weight of each new point in an EWMA, if > 0
+}
+
+// newSmoother returns a smoother for spec, which is "sma:N" for a moving
+// average of N points or "ewma:ALPHA" for an EWMA with weight ALPHA (between 0
+// and 1), or nil if spec is empty or invalid.
+func newSmoother(spec string) *smoother {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	switch parts[0] {
+	case "sma":
+		points, err := strconv.Atoi(parts[1])
+		if err != nil || points < 1 {
+			return nil
+		}
+		return &smoother{points: points}
+	case "ewma":
+		alpha, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || alpha <= 0 || alpha > 1 {
+			return nil
+		}
+		return &smoother{alpha: alpha}
+	}
+	return nil
+}
+
+// smooth returns the smoothed value at a point in a series, given the
+// smoothed values of the points before it.
+func (sm *smoother) smooth(s *Series, e *list.Element) Countable {
+	val := s.Values[e.Value.(*point).key]
+	if sm.alpha > 0 {
+		prev := e.Prev()
+		if prev == nil {
+			return val
+		}
+		last := s.Smoothed[prev.Value.(*point).key]
+		return Countable(sm.alpha)*val + Countable(1-sm.alpha)*last
+	}
+
+	sum, n := Countable(0), 0
+	for ; e != nil && n < sm.points; e = e.Prev() {
+		sum += s.Values[e.Value.(*point).key]
+		n += 1
+	}
+	return sum / Countable(n)
+}
+
+// resmooth recomputes the smoothed values of a series from a point onwards.
+// An EWMA depends only on the smoothed value before it, so it stops once they
+// no longer change, but a moving average continues through all of the points
+// whose averages include the point.
+func (s *Series) resmooth(from *list.Element, indicator int) {
+	ewma := s.smoother.alpha > 0
+	for e, n := from, 0; e != nil; e, n = e.Next(), n+1 {
+		if !ewma && n >= s.smoother.points {
+			return
+		}
+		key := e.Value.(*point).key
+		val := s.smoother.smooth(s, e)
+		if old, ok := s.Smoothed[key]; ok && old == val && e != from && ewma {
+			return
+		}
+		s.Smoothed[key] = val
+		s.changes.Update(key, indicator)
+	}
+}
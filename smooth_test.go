@@ -0,0 +1,77 @@
+package graphblast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSmoother(t *testing.T) {
+	if sm := newSmoother("sma:3"); sm == nil || sm.points != 3 {
+		t.Errorf("newSmoother didn't parse a moving average (%v)", sm)
+	}
+	if sm := newSmoother("ewma:0.5"); sm == nil || sm.alpha != 0.5 {
+		t.Errorf("newSmoother didn't parse an EWMA (%v)", sm)
+	}
+	for _, spec := range []string{"", "sma", "sma:0", "ewma:2", "median:3"} {
+		if newSmoother(spec) != nil {
+			t.Errorf("newSmoother accepted %q", spec)
+		}
+	}
+}
+
+func smoothed(ts *TimeSeries, start time.Time, offset int) Countable {
+	when := start.Add(time.Duration(offset) * time.Second)
+	return ts.unnamed.Smoothed[when.Format(time.RFC3339Nano)]
+}
+
+func TestSeriesMovingAverage(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Smoothing = "sma:2"
+	start := time.Unix(1400000000, 0)
+	ts.Add(start, 2, nil)
+	ts.Add(start.Add(time.Second), 4, nil)
+	ts.Add(start.Add(2*time.Second), 8, nil)
+
+	if smoothed(ts, start, 0) != 2 || smoothed(ts, start, 1) != 3 || smoothed(ts, start, 2) != 6 {
+		t.Errorf("Add computed the wrong averages (%v)", ts.unnamed.Smoothed)
+	}
+
+	// A point added out of order changes the averages after it.
+	ts.Add(start.Add(1500*time.Millisecond), 0, nil)
+	if smoothed(ts, start, 2) != 4 {
+		t.Errorf("Add didn't recompute the averages (%v)", ts.unnamed.Smoothed)
+	}
+}
+
+func TestSeriesMovingAverageUnchanged(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Smoothing = "sma:3"
+	start := time.Unix(1400000000, 0)
+	ts.Add(start, 0, nil)
+	ts.Add(start.Add(2*time.Second), 3, nil)
+	ts.Add(start.Add(3*time.Second), 0, nil)
+
+	// The average after the point added out of order stays the same, but
+	// the one after that still includes it.
+	ts.Add(start.Add(time.Second), 1.5, nil)
+	if smoothed(ts, start, 2) != 1.5 || smoothed(ts, start, 3) != 1.5 {
+		t.Errorf("Add stopped recomputing the averages early (%v)", ts.unnamed.Smoothed)
+	}
+}
+
+func TestSeriesEWMA(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Smoothing = "ewma:0.5"
+	ts.Window = 2
+	start := time.Unix(1400000000, 0)
+	ts.Add(start, 4, nil)
+	ts.Add(start.Add(time.Second), 8, nil)
+	ts.Add(start.Add(2*time.Second), 0, nil)
+
+	if smoothed(ts, start, 1) != 6 || smoothed(ts, start, 2) != 3 {
+		t.Errorf("Add computed the wrong EWMA (%v)", ts.unnamed.Smoothed)
+	}
+	if len(ts.unnamed.Smoothed) != 2 {
+		t.Errorf("Add didn't drop smoothed values (%v)", ts.unnamed.Smoothed)
+	}
+}
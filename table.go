@@ -0,0 +1,157 @@
+package graphblast
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Row is the fields of a JSON object read by a Table.
+type Row map[string]interface{}
+
+// Table parses lines as JSON objects, and shows a window of them as rows,
+// with a column for each field.
+type Table struct {
+	sync.Mutex // held while the graph is read into or sent
+
+	Values   map[string]Row
+	Columns  []string // the fields shown, in order
+	columns  map[string]bool
+	times    *list.List // of *point, in the order rows were added
+	changes  *changeLog
+	revision int // incremented whenever rows are added or dropped
+
+	Layout string        // the layout to use (interpreted by JS)
+	Label  string        // the label of the display
+	Fields string        // comma-separated fields to show, or all if empty
+	Window int           // the number of rows to retain, if > 0
+	MaxAge time.Duration // the age of the oldest rows to retain, if > 0
+
+	Colors   string // the colors to use when displaying the graph
+	FontSize string // the CSS font size to use when displaying the graph
+
+	Count    int // the number of values encountered so far
+	Filtered int // the number of values filtered out so far
+	Errors   int // the number of values skipped due to errors so far
+}
+
+func NewTable() *Table {
+	return &Table{
+		Layout:  "table",
+		Window:  100,
+		Values:  make(map[string]Row, 1024),
+		Columns: make([]string, 0),
+		columns: make(map[string]bool),
+		times:   list.New(),
+		changes: newChangeLog()}
+}
+
+func (tab *Table) Changed(indicator int) (bool, int) {
+	if tab.revision <= indicator {
+		return false, indicator
+	}
+	return true, tab.revision
+}
+
+// Add adds a row. If Fields is set, only those fields are kept (and rows with
+// none of them are filtered out); otherwise, any new fields become columns.
+func (tab *Table) Add(row Row, err error) {
+	if err != nil {
+		tab.Errors += 1
+		return
+	}
+
+	if tab.Fields != "" {
+		if len(tab.Columns) == 0 {
+			for _, field := range strings.Split(tab.Fields, ",") {
+				tab.addColumn(strings.TrimSpace(field))
+			}
+		}
+		kept := make(Row, len(tab.Columns))
+		for _, column := range tab.Columns {
+			if val, ok := row[column]; ok {
+				kept[column] = val
+			}
+		}
+		if len(kept) == 0 {
+			tab.Filtered += 1
+			return
+		}
+		row = kept
+	} else {
+		for field := range row {
+			tab.addColumn(field)
+		}
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%v", tab.Count)
+	tab.Values[key] = row
+	tab.times.PushBack(&point{now, key})
+	tab.Count += 1
+	tab.revision += 1
+	tab.changes.Update(key, tab.revision)
+	tab.Expire(now)
+}
+
+// addColumn adds a column for a field, if it doesn't already have one.
+func (tab *Table) addColumn(field string) {
+	if field == "" || tab.columns[field] {
+		return
+	}
+	tab.columns[field] = true
+	tab.Columns = append(tab.Columns, field)
+}
+
+// Expire drops the oldest rows beyond the window, and those that have become
+// older than MaxAge as of now.
+func (tab *Table) Expire(now time.Time) {
+	cutoff := time.Time{}
+	if tab.MaxAge > 0 {
+		cutoff = now.Add(-tab.MaxAge)
+	}
+
+	dropped := 0
+	for tab.times.Len() > 0 {
+		front := tab.times.Front()
+		oldest := front.Value.(*point)
+		if (tab.Window <= 0 || tab.times.Len() <= tab.Window) && !oldest.when.Before(cutoff) {
+			break
+		}
+		tab.times.Remove(front)
+		delete(tab.Values, oldest.key)
+		tab.changes.Remove(oldest.key, tab.revision+1)
+		dropped += 1
+	}
+	if dropped > 0 {
+		tab.revision += 1
+	}
+}
+
+// Delta returns the rows added and dropped since the indicator value was
+// returned by Changed, or the whole table if they are no longer known.
+func (tab *Table) Delta(indicator int) interface{} {
+	return keyedDelta(tab, tab.changes, indicator, "Values")
+}
+
+// ParseRow parses a line as a JSON object.
+func ParseRow(line string) (Row, error) {
+	var row Row
+	if err := json.Unmarshal([]byte(line), &row); err != nil {
+		return nil, err
+	} else if row == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	return row, nil
+}
+
+func (tab *Table) Read(reader io.Reader) error {
+	return doRead(reader, tab, func(line string) {
+		tab.Add(ParseRow(strings.TrimSpace(line)))
+	})
+}
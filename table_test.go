@@ -0,0 +1,85 @@
+package graphblast
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableAdd(t *testing.T) {
+	tab := NewTable()
+	tab.Add(Row{"b": "x", "a": 1.0}, nil)
+	tab.Add(Row{"c": true, "a": 2.0}, nil)
+
+	if tab.Count != 2 || len(tab.Values) != 2 {
+		t.Error("Add didn't store the rows")
+	}
+	if tab.Values["1"]["a"] != 2.0 {
+		t.Errorf("Add stored the wrong row (%v)", tab.Values)
+	}
+	if len(tab.Columns) != 3 || tab.Columns[2] != "c" {
+		t.Errorf("Add didn't add columns for new fields (%v)", tab.Columns)
+	}
+
+	tab.Add(nil, errors.New("fail"))
+	if tab.Errors != 1 || tab.Count != 2 {
+		t.Error("Add with error didn't increment the error count")
+	}
+}
+
+func TestTableAddFields(t *testing.T) {
+	tab := NewTable()
+	tab.Fields = "status, path"
+	tab.Add(Row{"path": "/", "status": 200.0, "bytes": 10.0}, nil)
+	tab.Add(Row{"bytes": 10.0}, nil)
+
+	if len(tab.Columns) != 2 || tab.Columns[0] != "status" || tab.Columns[1] != "path" {
+		t.Errorf("Add used the wrong columns (%v)", tab.Columns)
+	}
+	if _, ok := tab.Values["0"]["bytes"]; ok {
+		t.Error("Add kept a field that isn't a column")
+	}
+	if tab.Count != 1 || tab.Filtered != 1 {
+		t.Error("Add didn't filter a row with none of the fields")
+	}
+}
+
+func TestTableExpire(t *testing.T) {
+	tab := NewTable()
+	tab.Window = 2
+	tab.Read(strings.NewReader(`{"a": 1}` + "\n" + `{"a": 2}` + "\n" + `{"a": 3}` + "\n"))
+	if len(tab.Values) != 2 {
+		t.Errorf("Add didn't drop rows beyond the window (%v)", tab.Values)
+	}
+
+	tab.MaxAge = time.Minute
+	tab.Expire(time.Now().Add(time.Hour))
+	if len(tab.Values) != 0 {
+		t.Errorf("Expire didn't drop old rows (%v)", tab.Values)
+	}
+}
+
+func TestTableRead(t *testing.T) {
+	tab := NewTable()
+	tab.Read(strings.NewReader(`{"a": {"b": [1, 2]}}` + "\nnot json\n[1, 2]\nnull\n"))
+	if tab.Count != 1 || tab.Errors != 3 {
+		t.Errorf("Read didn't reject lines that aren't objects (%v)", tab.Errors)
+	}
+}
+
+func TestTableDelta(t *testing.T) {
+	tab := NewTable()
+	tab.Add(Row{"a": 1.0}, nil)
+	_, last := tab.Changed(0)
+	tab.Add(Row{"a": 2.0}, nil)
+
+	delta, err := json.Marshal(tab.Delta(last))
+	if err != nil {
+		t.Fatalf("Delta couldn't be marshaled: %v", err)
+	}
+	if !strings.Contains(string(delta), `"Values":{"1":{"a":2}}`) {
+		t.Errorf("Delta included the wrong rows (%s)", delta)
+	}
+}
@@ -2,29 +2,398 @@ package graphblast
 
 import (
 	"container/list"
+	"encoding/json"
+	"errors"
 	"io"
 	"math"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// A Series is a window of timestamped values belonging to a TimeSeries.
+type Series struct {
+	Values  map[string]Countable
+	times   *list.List // of *point, ordered by time
+	changes *changeLog
+
+	tiers      []*tier // rollups of the values, from finest to coarsest
+	resolution int     // the tier (from 1) last sent, or 0 for raw values
+
+	Smoothed map[string]Countable // the smoothed values, if smoothing
+	smoother *smoother
+
+	Min Countable // the minimum value retained
+	Max Countable // the maximum value retained
+
+	lows  *extreme // tracks Min
+	highs *extreme // tracks Max
+
+	source  string // the series the values are computed from, if quantiles
+	updated int    // the indicator of the latest value added
+}
+
+func newSeries(values map[string]Countable) *Series {
+	return &Series{
+		Values:  values,
+		times:   list.New(),
+		changes: newChangeLog(),
+		lows:    newExtreme(func(a, b Countable) bool { return a <= b }),
+		highs:   newExtreme(func(a, b Countable) bool { return a >= b }),
+		Min:     Countable(math.Inf(1)),
+		Max:     Countable(math.Inf(-1))}
+}
+
+// point is the time of a value in a Series, and the key it's stored under.
+type point struct {
+	when time.Time
+	key  string
+}
+
+// add records a value at a time, replacing any value already there. It
+// returns whether it replaced one.
+func (s *Series) add(when time.Time, val Countable, indicator int) bool {
+	key := when.Format(time.RFC3339Nano)
+	old, exists := s.Values[key]
+	newest := s.times.Len() == 0 || !s.times.Back().Value.(*point).when.After(when)
+	var e *list.Element
+	if !exists {
+		e = insertPoint(s.times, &point{when, key})
+	} else if s.smoother != nil {
+		e = findPoint(s.times, key)
+	}
+	s.Values[key] = val
+	s.changes.Update(key, indicator)
+	s.updated = indicator
+	if s.smoother != nil {
+		s.resmooth(e, indicator)
+	}
+	for _, t := range s.tiers {
+		t.add(when, old, exists, val, indicator)
+	}
+
+	// Values are expected to arrive mostly in order; any others require
+	// looking through all of the values retained.
+	if !newest {
+		s.rescan()
+		return exists
+	}
+	for _, x := range []*extreme{s.lows, s.highs} {
+		if exists {
+			x.replace(s.times, s.Values, old)
+		} else {
+			x.push(s.times.Back(), s.Values)
+		}
+	}
+	s.bounds()
+	return exists
+}
+
+// bounds sets Min and Max from lows and highs.
+func (s *Series) bounds() {
+	s.Min = s.lows.value(s.Values, Countable(math.Inf(1)))
+	s.Max = s.highs.value(s.Values, Countable(math.Inf(-1)))
+}
+
+// evict drops the oldest values, so that no more than window values (if
+// window is positive) and no values from before cutoff are retained. It
+// returns the number of values dropped.
+func (s *Series) evict(indicator int, window int, cutoff time.Time) int {
+	dropped := 0
+	for s.times.Len() > 0 {
+		front := s.times.Front()
+		oldest := front.Value.(*point)
+		if (window <= 0 || s.times.Len() <= window) && !oldest.when.Before(cutoff) {
+			break
+		}
+		s.lows.drop(front)
+		s.highs.drop(front)
+		s.times.Remove(front)
+		delete(s.Values, oldest.key)
+		delete(s.Smoothed, oldest.key)
+		s.changes.Remove(oldest.key, indicator)
+		dropped += 1
+	}
+	if dropped == 0 {
+		return 0
+	}
+
+	// Rollups are dropped once none of their values are retained.
+	for _, t := range s.tiers {
+		if s.times.Len() == 0 {
+			t.evict(s.newest(), indicator)
+		} else {
+			t.evict(s.times.Front().Value.(*point).when, indicator)
+		}
+	}
+	s.bounds()
+	return dropped
+}
+
+// empty returns whether the series retains no values, even rolled up.
+func (s *Series) empty() bool {
+	for _, t := range s.tiers {
+		if len(t.rollups) > 0 {
+			return false
+		}
+	}
+	return len(s.Values) == 0
+}
+
+// newest returns the time of the newest rollup interval in the series.
+func (s *Series) newest() time.Time {
+	newest := time.Time{}
+	for _, t := range s.tiers {
+		if t.starts.Len() > 0 {
+			end := t.starts.Back().Value.(*point).when.Add(t.interval)
+			if end.After(newest) {
+				newest = end
+			}
+		}
+	}
+	return newest
+}
+
+// rescan rebuilds lows and highs (and so Min and Max) from the values
+// retained.
+func (s *Series) rescan() {
+	for _, x := range []*extreme{s.lows, s.highs} {
+		x.elements.Init()
+		for e := s.times.Front(); e != nil; e = e.Next() {
+			x.push(e, s.Values)
+		}
+	}
+	s.bounds()
+}
+
+// An extreme tracks the minimum or maximum of the values of a series as its
+// oldest values are dropped and newer ones added, without looking through all
+// of them each time. It holds the elements (of the series' times) whose
+// values beat all of the values after them, oldest first, so the front holds
+// the extreme value.
+type extreme struct {
+	elements *list.List
+	beats    func(a, b Countable) bool // whether a value makes b irrelevant
+}
+
+func newExtreme(beats func(a, b Countable) bool) *extreme {
+	return &extreme{list.New(), beats}
+}
+
+// value returns the extreme value, or none if there are no values.
+func (x *extreme) value(values map[string]Countable, none Countable) Countable {
+	if x.elements.Len() == 0 {
+		return none
+	}
+	return values[x.elements.Front().Value.(*list.Element).Value.(*point).key]
+}
+
+// push adds the element of the newest value.
+func (x *extreme) push(e *list.Element, values map[string]Countable) {
+	val := values[e.Value.(*point).key]
+	for x.elements.Len() > 0 {
+		back := x.elements.Back()
+		if !x.beats(val, values[back.Value.(*list.Element).Value.(*point).key]) {
+			break
+		}
+		x.elements.Remove(back)
+	}
+	x.elements.PushBack(e)
+}
+
+// replace updates the extreme after the newest value (the last element of
+// times) changes from old, by adding back the elements its old value made
+// irrelevant, unless the new value does too.
+func (x *extreme) replace(times *list.List, values map[string]Countable, old Countable) {
+	newest := times.Back()
+	x.elements.Remove(x.elements.Back())
+	if !x.beats(values[newest.Value.(*point).key], old) {
+		e := times.Front()
+		if x.elements.Len() > 0 {
+			e = x.elements.Back().Value.(*list.Element).Next()
+		}
+		for ; e != newest; e = e.Next() {
+			x.push(e, values)
+		}
+	}
+	x.push(newest, values)
+}
+
+// drop removes the element of the oldest value, if it's held.
+func (x *extreme) drop(oldest *list.Element) {
+	if x.elements.Len() > 0 && x.elements.Front().Value.(*list.Element) == oldest {
+		x.elements.Remove(x.elements.Front())
+	}
+}
+
+// fit returns the finest resolution at which the series has no more than
+// width points, or the coarsest resolution if none do.
+func (s *Series) fit(width int) int {
+	if width <= 0 || len(s.Values) <= width {
+		return 0
+	}
+	for i, t := range s.tiers {
+		if len(t.rollups) <= width {
+			return i + 1
+		}
+	}
+	return len(s.tiers)
+}
+
+// seriesView is how a Series is marshaled: with its values at a single
+// resolution, either raw or rolled up.
+type seriesView struct {
+	Min        *Countable // nil if the series is empty
+	Max        *Countable
+	Resolution string `json:",omitempty"` // the rollup interval
+	Values     map[string]Countable
+	Smoothed   map[string]Countable `json:",omitempty"`
+	Rollups    map[string]*Rollup   `json:",omitempty"`
+	Removed    []string             `json:",omitempty"`
+	Partial    bool                 `json:",omitempty"`
+}
+
+// full returns a view of the whole series at its current resolution.
+func (s *Series) full() *seriesView {
+	view := &seriesView{Min: finite(s.Min), Max: finite(s.Max), Values: s.Values}
+	view.Smoothed = s.Smoothed
+	if s.resolution > 0 {
+		t := s.tiers[s.resolution-1]
+		view.Resolution = t.interval.String()
+		view.Values = map[string]Countable{}
+		view.Smoothed = nil
+		view.Rollups = t.rollups
+	}
+	return view
+}
+
+// delta returns a view of the changes since indicator at the resolution that
+// fits width, or of the whole series if that resolution differs from the one
+// last sent. It returns false if the changes are no longer known.
+func (s *Series) delta(indicator int, width int) (*seriesView, bool) {
+	// Every change log is asked for its changes, so that they all forget
+	// about the same ones.
+	updated, removed, ok := s.changes.Since(indicator)
+	tierUpdated := make([][]string, len(s.tiers))
+	tierRemoved := make([][]string, len(s.tiers))
+	for i, t := range s.tiers {
+		var tierOk bool
+		tierUpdated[i], tierRemoved[i], tierOk = t.changes.Since(indicator)
+		ok = ok && tierOk
+	}
+	if !ok {
+		return nil, false
+	}
+
+	resolution := s.fit(width)
+	if resolution != s.resolution {
+		s.resolution = resolution
+		return s.full(), true
+	}
+
+	view := &seriesView{Min: finite(s.Min), Max: finite(s.Max), Partial: true}
+	view.Values = make(map[string]Countable, len(updated))
+	if resolution == 0 {
+		for _, key := range updated {
+			view.Values[key] = s.Values[key]
+		}
+		if s.smoother != nil {
+			view.Smoothed = make(map[string]Countable, len(updated))
+			for _, key := range updated {
+				view.Smoothed[key] = s.Smoothed[key]
+			}
+		}
+		view.Removed = removed
+		return view, true
+	}
+
+	t := s.tiers[resolution-1]
+	view.Resolution = t.interval.String()
+	view.Rollups = make(map[string]*Rollup, len(tierUpdated[resolution-1]))
+	for _, key := range tierUpdated[resolution-1] {
+		view.Rollups[key] = t.rollups[key]
+	}
+	view.Removed = tierRemoved[resolution-1]
+	return view, true
+}
+
+// finite returns a pointer to c, or nil if c is infinite or NaN (and so can't
+// be marshaled to JSON).
+func finite(c Countable) *Countable {
+	if math.IsInf(float64(c), 0) || math.IsNaN(float64(c)) {
+		return nil
+	}
+	return &c
+}
+
+// empty returns whether a view of changes has nothing in it.
+func (view *seriesView) empty() bool {
+	return view.Partial && len(view.Values) == 0 &&
+		len(view.Rollups) == 0 && len(view.Removed) == 0
+}
+
+// sample is the last value of a counter, from which a rate is computed.
+type sample struct {
+	when time.Time
+	val  Countable
+}
+
+// interval collects the values of a series over a period of time, so that
+// their quantiles can be plotted instead of the values themselves.
+type interval struct {
+	start  time.Time
+	sketch *QuantileSketch
+	dirty  bool // whether values have been added since it was last plotted
+}
+
 type TimeSeries struct {
-	Values map[string]Countable
-	times  *list.List
+	sync.Mutex // held while the graph is read into or sent
+
+	*Alert
+	*Input
+
+	Values  map[string]Countable // the values of the unnamed series
+	Series  map[string]*Series   // the named series, in multi-series mode
+	unnamed *Series
+
+	newest   time.Time // the time of the newest point
+	revision int       // incremented whenever points are added or dropped
+	dropped  int       // the revision when a series was last dropped
+
+	Layout string        // the layout to use (interpreted by JS)
+	Label  string        // the label of the histogram
+	Width  int           // the maximum graph width in pixels
+	Height int           // the maximum graph height in pixels
+	Window int           // the number of points to retain per series, if > 0
+	MaxAge time.Duration // the age of the oldest points to retain, if > 0
+
+	// The number of named series to retain, if > 0. Once there are more,
+	// the least recently updated series is dropped.
+	MaxSeries int
+
+	SeriesColumn int    // the column (from 1) naming each value's series, or 0
+	TimeColumn   int    // the column (from 1) holding each value's time, or 0
+	TimeField    string // the path (or CSV column) to each value's time, or ""
+	TimeFormat   string // "rfc3339", "unix", "unixms", or a Go time layout
 
-	Layout string // the layout to use (interpreted by JS)
-	Label  string // the label of the histogram
-	Width  int    // the maximum graph width in pixels
-	Height int    // the maximum graph height in pixels
-	Window int    // the number of points to retain
+	Rollups   string // comma-separated intervals to roll values up into
+	Smoothing string // "sma:N" to average the last N points, or "ewma:ALPHA"
+
+	Quantiles string        // comma-separated quantiles to plot, if any
+	Interval  time.Duration // the period over which to compute quantiles
+	intervals map[string]*interval
+
+	Rate     bool // whether to plot the per-second rate of increase of counters
+	counters map[string]*sample
 
 	Allowed Range
 
 	Colors   string // the colors to use when displaying the graph
 	FontSize string // the CSS font size to use when displaying the graph
 
-	Min Countable // the minimum value encountered so far
-	Max Countable // the maximum value encountered so far
+	Min Countable // the minimum value retained
+	Max Countable // the maximum value retained
 
 	Count    int // the number of values encountered so far
 	Filtered int // the number of values filtered out so far
@@ -32,54 +401,516 @@ type TimeSeries struct {
 }
 
 func NewTimeSeries() *TimeSeries {
+	values := make(map[string]Countable, 1024)
 	return &TimeSeries{
-		times:   list.New(),
-		Layout:  "time-series",
-		Window:  100,
-		Values:  make(map[string]Countable, 1024),
-		Allowed: Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
-		Min:     Countable(math.Inf(1)),
-		Max:     Countable(math.Inf(-1))}
+		Alert:     NewAlert(),
+		Input:     NewInput(),
+		unnamed:   newSeries(values),
+		Layout:    "time-series",
+		Window:    100,
+		MaxSeries: 20,
+		Values:    values,
+		Series:    make(map[string]*Series),
+		Rollups:   "10s,1m,10m,1h",
+		Interval:  10 * time.Second,
+		intervals: make(map[string]*interval),
+		counters:  make(map[string]*sample),
+		Allowed:   Range{Countable(math.Inf(-1)), Countable(math.Inf(1))},
+		Min:       Countable(math.Inf(1)),
+		Max:       Countable(math.Inf(-1))}
 }
 
 func (ts *TimeSeries) Changed(indicator int) (bool, int) {
-	if ts.Count <= indicator {
+	if ts.revision <= indicator {
 		return false, indicator
 	}
-	return true, ts.Count
+	return true, ts.revision
+}
+
+// Expire plots the quantiles of the intervals that have changed, and drops the
+// points that have become older than MaxAge as of now. Time only passes this
+// way when points are stamped with the time they're read; otherwise, points
+// only expire as newer ones are added.
+func (ts *TimeSeries) Expire(now time.Time) {
+	for name, current := range ts.intervals {
+		ts.plot(name, current)
+	}
+	if ts.MaxAge <= 0 || ts.TimeColumn > 0 || ts.TimeField != "" {
+		return
+	}
+	if ts.evict(now) {
+		ts.rescan()
+	}
 }
 
+// evict drops the points beyond the window, or from before MaxAge prior to
+// the time given, from all series, and then any named series left empty. It
+// returns whether any were dropped.
+func (ts *TimeSeries) evict(newest time.Time) bool {
+	cutoff := time.Time{}
+	if ts.MaxAge > 0 {
+		cutoff = newest.Add(-ts.MaxAge)
+	}
+
+	dropped := ts.unnamed.evict(ts.revision+1, ts.Window, cutoff)
+	for name, series := range ts.Series {
+		n := series.evict(ts.revision+1, ts.Window, cutoff)
+		if n > 0 && series.empty() {
+			ts.drop(name)
+			ts.dropped = ts.revision + 1
+		}
+		dropped += n
+	}
+	if dropped == 0 {
+		return false
+	}
+	ts.revision += 1
+	return true
+}
+
+// update brings Min and Max up to date after a value is added to a series,
+// evicting the points that are no longer retained. Only when values are
+// dropped or replaced does every series need to be looked through.
+func (ts *TimeSeries) update(series *Series, replaced bool) {
+	if ts.evict(ts.newest) || replaced {
+		ts.rescan()
+		return
+	}
+	if series.Min < ts.Min {
+		ts.Min = series.Min
+	}
+	if series.Max > ts.Max {
+		ts.Max = series.Max
+	}
+}
+
+// rescan recomputes Min and Max from the values retained in all series.
+func (ts *TimeSeries) rescan() {
+	ts.Min, ts.Max = ts.unnamed.Min, ts.unnamed.Max
+	for _, series := range ts.Series {
+		if series.Min < ts.Min {
+			ts.Min = series.Min
+		}
+		if series.Max > ts.Max {
+			ts.Max = series.Max
+		}
+	}
+}
+
+// Add records a value in the unnamed series.
 func (ts *TimeSeries) Add(when time.Time, val Countable, err error) {
-	if err != nil {
+	ts.AddTo("", when, val, err)
+}
+
+// AddTo records a value in the named series, creating the series if it
+// doesn't exist yet. The empty name refers to the unnamed series.
+func (ts *TimeSeries) AddTo(name string, when time.Time, val Countable, err error) {
+	if err == errFiltered {
+		ts.Filtered += 1
+		return
+	} else if err != nil {
 		ts.Errors += 1
 		return
-	} else if !ts.Allowed.Contains(val) {
+	}
+
+	if ts.Rate {
+		rate, ok := ts.rate(name, when, val)
+		if !ok {
+			ts.Count += 1
+			return
+		}
+		val = rate
+	}
+
+	if !ts.Allowed.Contains(val) || ts.late(name, when) {
 		ts.Filtered += 1
 		return
 	}
 
-	if val < ts.Min {
-		ts.Min = val
+	ts.Count += 1
+	ts.revision += 1
+	ts.observe(name, when, val)
+	if when.After(ts.newest) {
+		ts.newest = when
 	}
-	if val > ts.Max {
-		ts.Max = val
+	if ts.Quantiles == "" {
+		series := ts.series(name)
+		ts.update(series, series.add(when, val, ts.revision))
+	} else {
+		ts.addQuantiles(name, when, val)
 	}
+}
 
-	ts.Count += 1
-	key := when.Format(time.RFC3339Nano)
-	ts.times.PushBack(key)
-	ts.Values[key] = val
-	if ts.times.Len() > ts.Window {
-		drop := ts.times.Front()
-		ts.times.Remove(drop)
-		dropped := drop.Value.(string)
-		delete(ts.Values, dropped)
+// addQuantiles adds a value to the current interval of the named series,
+// whose quantiles are plotted rather than the values themselves. Estimating
+// them is expensive, so an interval is only plotted once it's over, or by
+// Expire.
+func (ts *TimeSeries) addQuantiles(name string, when time.Time, val Countable) {
+	start := when.Truncate(ts.Interval)
+	current := ts.intervals[name]
+	if current == nil || !current.start.Equal(start) {
+		if current != nil {
+			ts.plot(name, current)
+		}
+		current = &interval{start: start, sketch: NewQuantileSketch(ts.Quantiles)}
+		ts.intervals[name] = current
+	}
+	current.sketch.Add(val)
+	current.dirty = true
+}
+
+// plot plots the quantiles of the values in an interval of the named series,
+// each as its own series, if values have been added since it was last
+// plotted.
+func (ts *TimeSeries) plot(name string, current *interval) {
+	if !current.dirty {
+		return
+	}
+	current.dirty = false
+	ts.revision += 1
+	for _, estimate := range current.sketch.Estimates() {
+		quantileName := strings.TrimSpace(name + " " + estimate.Name)
+		series := ts.series(quantileName)
+		series.source = name
+		ts.update(series, series.add(current.start, estimate.Value, ts.revision))
+	}
+}
+
+// late returns whether a value belongs to an interval before the current one
+// of the named series, when plotting quantiles. Only the current interval's
+// values are kept to estimate quantiles from, so earlier intervals can't be
+// updated, and values for them are filtered out.
+func (ts *TimeSeries) late(name string, when time.Time) bool {
+	current := ts.intervals[name]
+	return ts.Quantiles != "" && current != nil &&
+		when.Truncate(ts.Interval).Before(current.start)
+}
+
+// rate returns the per-second rate at which the named counter has increased
+// since its last value, or false if there's no earlier value to compare with
+// (as for the first value, or one out of order). A counter that decreases is
+// assumed to have been reset to zero.
+func (ts *TimeSeries) rate(name string, when time.Time, val Countable) (Countable, bool) {
+	last := ts.counters[name]
+	if last != nil && !when.After(last.when) {
+		return 0, false
+	}
+	ts.counters[name] = &sample{when, val}
+	if last == nil {
+		return 0, false
+	}
+
+	increase := val - last.val
+	if val < last.val {
+		increase = val
+	}
+	return increase / Countable(when.Sub(last.when).Seconds()), true
+}
+
+// series returns the series with the given name, creating it if it doesn't
+// exist yet. The empty name refers to the unnamed series.
+func (ts *TimeSeries) series(name string) *Series {
+	series := ts.unnamed
+	if name != "" {
+		series = ts.Series[name]
+		if series == nil {
+			if ts.MaxSeries > 0 && len(ts.Series) >= ts.MaxSeries {
+				ts.dropSeries()
+			}
+			series = newSeries(make(map[string]Countable))
+			series.source = name
+			ts.Series[name] = series
+		}
+	}
+	if series.tiers == nil {
+		series.tiers = newTiers(ts.Rollups)
+		series.smoother = newSmoother(ts.Smoothing)
+		if series.smoother != nil {
+			series.Smoothed = make(map[string]Countable)
+		}
+	}
+	return series
+}
+
+// dropSeries drops the least recently updated named series.
+func (ts *TimeSeries) dropSeries() {
+	least := ""
+	for name, series := range ts.Series {
+		if least == "" || series.updated < ts.Series[least].updated {
+			least = name
+		}
+	}
+	ts.drop(least)
+	ts.dropped = ts.revision
+	ts.rescan()
+}
+
+// drop drops a named series, along with the counter or quantile interval its
+// values come from, unless another series still comes from it.
+func (ts *TimeSeries) drop(name string) {
+	source := ts.Series[name].source
+	delete(ts.Series, name)
+	for _, series := range ts.Series {
+		if series.source == source {
+			return
+		}
+	}
+	delete(ts.counters, source)
+	delete(ts.intervals, source)
+}
+
+// plainTimeSeries has the fields of a TimeSeries but none of its methods, so
+// that it can be embedded in the views a TimeSeries is marshaled as.
+type plainTimeSeries TimeSeries
+
+// timeSeriesView is how a TimeSeries is marshaled: the unnamed series is at
+// the top level, and each series is at a single resolution. Min and Max are
+// null when no values are retained.
+type timeSeriesView struct {
+	*plainTimeSeries
+	Min        *Countable
+	Max        *Countable
+	Resolution string `json:",omitempty"`
+	Values     map[string]Countable
+	Smoothed   map[string]Countable `json:",omitempty"`
+	Rollups    map[string]*Rollup   `json:",omitempty"`
+	Removed    []string             `json:",omitempty"`
+	Series     map[string]*seriesView
+	Partial    bool `json:",omitempty"`
+}
+
+func newTimeSeriesView(ts *TimeSeries, unnamed *seriesView, series map[string]*seriesView) *timeSeriesView {
+	return &timeSeriesView{
+		plainTimeSeries: (*plainTimeSeries)(ts),
+		Min:             finite(ts.Min),
+		Max:             finite(ts.Max),
+		Resolution:      unnamed.Resolution,
+		Values:          unnamed.Values,
+		Smoothed:        unnamed.Smoothed,
+		Rollups:         unnamed.Rollups,
+		Removed:         unnamed.Removed,
+		Series:          series,
+		Partial:         unnamed.Partial}
+}
+
+func (ts *TimeSeries) MarshalJSON() ([]byte, error) {
+	series := make(map[string]*seriesView, len(ts.Series))
+	for name, s := range ts.Series {
+		series[name] = s.full()
+	}
+	return json.Marshal(newTimeSeriesView(ts, ts.unnamed.full(), series))
+}
+
+// Delta returns the points added and evicted since the indicator value was
+// returned by Changed, or the whole time series if they are no longer known
+// or a series has been dropped since. Series whose resolution has changed are
+// sent whole.
+func (ts *TimeSeries) Delta(indicator int) interface{} {
+	unnamed, ok := ts.unnamed.delta(indicator, ts.Width)
+	if !ok || !unnamed.Partial || indicator < ts.dropped {
+		return ts
+	}
+
+	series := make(map[string]*seriesView)
+	for name, s := range ts.Series {
+		view, ok := s.delta(indicator, ts.Width)
+		if !ok {
+			return ts
+		}
+		if !view.empty() {
+			series[name] = view
+		}
+	}
+	return newTimeSeriesView(ts, unnamed, series)
+}
+
+// ParseTime parses a timestamp in the given format: "rfc3339" (the default),
+// "unix" or "unixms" for (possibly fractional) seconds or milliseconds since
+// the epoch, or otherwise a layout as understood by time.Parse.
+func ParseTime(str string, format string) (time.Time, error) {
+	switch format {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339Nano, str)
+	case "unix", "unixms":
+		stamp, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == "unixms" {
+			stamp /= 1000
+		}
+		sec, frac := math.Modf(stamp)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	default:
+		return time.Parse(format, str)
+	}
+}
+
+// splitLine separates a line into a time, the name of a series, and a value,
+// according to TimeColumn, SeriesColumn and Field. Unless Field is set, the
+// value must be the only other column. A timestamp spanning several fields is
+// a single column, but a numbered Field still counts each of its fields, as
+// it would for any other graph.
+func (ts *TimeSeries) splitLine(line string) (time.Time, string, string, error) {
+	if ts.json() {
+		return ts.splitJSON(line)
+	} else if ts.TimeColumn <= 0 && ts.SeriesColumn <= 0 {
+		value, err := ts.Value(line)
+		return time.Now(), "", value, err
+	}
+
+	fields := ts.fields(line)
+	valueField := -1
+	if _, err := strconv.Atoi(ts.Field); err == nil {
+		if valueField, err = ts.index(fields); err != nil {
+			return time.Time{}, "", "", err
+		}
+	}
+	columns := 1
+	if ts.TimeColumn > 0 && ts.whitespace() {
+		// Timestamps with spaces in their layout span several fields, so
+		// join those into a single column.
+		span := strings.Count(ts.TimeFormat, " ") + 1
+		i := ts.TimeColumn - 1
+		if i+span > len(fields) {
+			return time.Time{}, "", "", errors.New("invalid line")
+		}
+		stamp := strings.Join(fields[i:i+span], " ")
+		fields = append(fields[:i], append([]string{stamp}, fields[i+span:]...)...)
+		columns += 1
+		if valueField >= i+span {
+			valueField -= span - 1
+		} else if valueField >= i {
+			return time.Time{}, "", "", errors.New("field is part of the time")
+		}
+	}
+	if ts.SeriesColumn > 0 {
+		columns += 1
+	}
+
+	valueColumn := 0
+	if ts.Field != "" {
+		if valueField < 0 {
+			i, err := ts.index(fields)
+			if err != nil {
+				return time.Time{}, "", "", err
+			}
+			valueField = i
+		}
+		valueColumn = valueField + 1
+		columns = len(fields)
+	}
+	if len(fields) != columns || ts.TimeColumn > columns || ts.SeriesColumn > columns {
+		return time.Time{}, "", "", errors.New("invalid line")
+	}
+
+	when, name, value := time.Now(), "", ""
+	for i, field := range fields {
+		switch i + 1 {
+		case ts.TimeColumn:
+			parsed, err := ParseTime(field, ts.TimeFormat)
+			if err != nil {
+				return time.Time{}, "", "", err
+			}
+			when = parsed
+		case ts.SeriesColumn:
+			name = field
+		case valueColumn:
+			value = field
+		default:
+			if valueColumn == 0 {
+				value = field
+			}
+		}
+	}
+	value, err := ts.extract(value)
+	return when, name, value, err
+}
+
+// splitJSON separates a JSON object into a time, according to TimeField, and
+// a value, according to Field.
+func (ts *TimeSeries) splitJSON(line string) (time.Time, string, string, error) {
+	if ts.TimeField == "" {
+		value, err := ts.Value(line)
+		return time.Now(), "", value, err
+	}
+
+	row, err := ParseRow(line)
+	if err != nil {
+		return time.Time{}, "", "", err
+	}
+	stamp, err := Lookup(row, ts.TimeField)
+	if err != nil {
+		return time.Time{}, "", "", err
+	}
+	when, err := ParseTime(stamp, ts.TimeFormat)
+	if err != nil {
+		return time.Time{}, "", "", err
+	}
+	value, err := Lookup(row, ts.Field)
+	if err != nil {
+		return time.Time{}, "", "", err
+	}
+	value, err = ts.extract(value)
+	return when, "", value, err
+}
+
+// addColumns adds the value in each column of a line of CSV to the series
+// named by the header line, other than the time column (TimeField or
+// TimeColumn). Empty values are skipped.
+func (ts *TimeSeries) addColumns(line string) {
+	fields := ts.fields(line)
+	if ts.readHeader(fields) {
+		return
+	} else if len(fields) != len(ts.names) {
+		ts.AddTo("", time.Time{}, 0, errors.New("invalid line"))
+		return
+	}
+
+	when, timeIndex := time.Now(), ts.TimeColumn-1
+	if ts.TimeField != "" {
+		i, ok := ts.header[ts.TimeField]
+		if !ok {
+			ts.AddTo("", when, 0, errors.New("missing time field"))
+			return
+		}
+		timeIndex = i
+	} else if timeIndex >= len(fields) {
+		ts.AddTo("", when, 0, errors.New("missing time column"))
+		return
+	}
+	if timeIndex >= 0 {
+		parsed, err := ParseTime(fields[timeIndex], ts.TimeFormat)
+		if err != nil {
+			ts.AddTo("", when, 0, err)
+			return
+		}
+		when = parsed
+	}
+
+	for i, field := range fields {
+		if i == timeIndex || field == "" {
+			continue
+		}
+		val, err := ts.parse(ts.extract(field))
+		ts.AddTo(ts.names[i], when, val, err)
 	}
 }
 
 func (ts *TimeSeries) Read(reader io.Reader) error {
-	return doRead(reader, func(line string) {
-		parsed, err := Parse(strings.TrimSpace(line))
-		ts.Add(time.Now(), parsed, err)
+	return doRead(reader, ts, func(line string) {
+		if ts.csv() {
+			ts.addColumns(strings.TrimSpace(line))
+			return
+		}
+		when, name, value, err := ts.splitLine(strings.TrimSpace(line))
+		if err == errSkipped {
+			return
+		} else if err != nil {
+			ts.AddTo("", when, 0, err)
+			return
+		}
+		parsed, err := ts.parse(value, nil)
+		ts.AddTo(name, when, parsed, err)
 	})
 }
@@ -1,7 +1,10 @@
 package graphblast
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"math/rand"
 	"strings"
 	"testing"
 	"time"
@@ -124,3 +127,512 @@ func TestTimeSeriesRead(t *testing.T) {
 		}
 	}
 }
+
+func TestTimeSeriesDelta(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Window = 2
+	ts.Add(time.Unix(1400000000, 0), 1, nil)
+	ts.Add(time.Unix(1400000001, 0), 2, nil)
+	_, indicator := ts.Changed(0)
+	ts.Add(time.Unix(1400000002, 0), 3, nil)
+
+	delta, err := json.Marshal(ts.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	added := time.Unix(1400000002, 0).Format(time.RFC3339Nano)
+	if !strings.Contains(string(delta), `"Values":{"`+added+`":3}`) {
+		t.Errorf("Delta included the wrong points (%s)", delta)
+	}
+	evicted := time.Unix(1400000000, 0).Format(time.RFC3339Nano)
+	if !strings.Contains(string(delta), `"Removed":["`+evicted+`"]`) {
+		t.Errorf("Delta did not include the evicted point (%s)", delta)
+	}
+
+	if ts.Delta(0) != ts {
+		t.Error("Delta did not return the whole time series for old changes")
+	}
+}
+
+func TestTimeSeriesAddTo(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Window = 1
+	ts.AddTo("p50", time.Unix(1400000000, 0), 1, nil)
+	ts.AddTo("p99", time.Unix(1400000000, 0), 10, nil)
+	ts.AddTo("p50", time.Unix(1400000001, 0), 2, nil)
+
+	if len(ts.Values) != 0 {
+		t.Error("AddTo recorded a value in the unnamed series")
+	}
+	if len(ts.Series) != 2 {
+		t.Fatal("AddTo did not create a series for each name")
+	}
+	p50 := ts.Series["p50"]
+	if len(p50.Values) != 1 {
+		t.Error("AddTo did not window the values of a series")
+	}
+	if p50.Values[time.Unix(1400000001, 0).Format(time.RFC3339Nano)] != 2 {
+		t.Error("AddTo dropped the wrong value for windowed series")
+	}
+	if p50.Min != 2 || p50.Max != 2 {
+		t.Error("AddTo recorded wrong value stat for series")
+	}
+	if ts.Min != 2 || ts.Max != 10 || ts.Count != 3 {
+		t.Error("AddTo recorded wrong stat for time series")
+	}
+}
+
+func TestTimeSeriesDeltaSeries(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.AddTo("p50", time.Unix(1400000000, 0), 1, nil)
+	ts.AddTo("p99", time.Unix(1400000000, 0), 10, nil)
+	_, indicator := ts.Changed(0)
+	ts.AddTo("p99", time.Unix(1400000001, 0), 20, nil)
+
+	delta, err := json.Marshal(ts.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	added := time.Unix(1400000001, 0).Format(time.RFC3339Nano)
+	if !strings.Contains(string(delta), `"p99":{"Min":10,"Max":20,"Values":{"`+added+`":20}`) {
+		t.Errorf("Delta included the wrong points for a series (%s)", delta)
+	}
+	if strings.Contains(string(delta), `"p50"`) {
+		t.Errorf("Delta included an unchanged series (%s)", delta)
+	}
+}
+
+func TestTimeSeriesAddToMaxSeries(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxSeries = 2
+	ts.Rate = true
+	start := time.Unix(1400000000, 0)
+	ts.AddTo("a", start, 1, nil)
+	ts.AddTo("b", start, 1, nil)
+	ts.AddTo("a", start.Add(time.Second), 2, nil)
+	ts.AddTo("b", start.Add(time.Second), 10, nil)
+	ts.AddTo("a", start.Add(2*time.Second), 3, nil)
+	_, indicator := ts.Changed(0)
+	ts.AddTo("c", start.Add(2*time.Second), 1, nil)
+	ts.AddTo("c", start.Add(3*time.Second), 2, nil)
+
+	if _, ok := ts.Series["b"]; ok || len(ts.Series) != 2 {
+		t.Errorf("AddTo didn't drop the least recently updated series (%v)", ts.Series)
+	}
+	if _, ok := ts.counters["b"]; ok {
+		t.Error("AddTo didn't drop the counter of a dropped series")
+	}
+	if ts.Max != 1 {
+		t.Errorf("AddTo didn't rescan after dropping a series (%v)", ts.Max)
+	}
+	if ts.Delta(indicator) != ts {
+		t.Error("Delta didn't send the whole graph after dropping a series")
+	}
+}
+
+func TestTimeSeriesReadSeries(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.SeriesColumn = 1
+	reader := strings.NewReader("p50 1\np99 2\np99 3\n5\n")
+	ts.Read(reader)
+	if ts.Count != 3 {
+		t.Error("Read failed to read the input fully")
+	}
+	if ts.Errors != 1 {
+		t.Error("Read failed to signal an error for a line without a series")
+	}
+	if len(ts.Series["p50"].Values) != 1 || len(ts.Series["p99"].Values) != 2 {
+		t.Error("Read failed to add values to the right series")
+	}
+
+	ts = NewTimeSeries()
+	ts.SeriesColumn = 2
+	reader = strings.NewReader("1 p50\n")
+	ts.Read(reader)
+	if ts.Series["p50"] == nil || ts.Series["p50"].Max != 1 {
+		t.Error("Read failed to use the configured series column")
+	}
+}
+
+func TestTimeSeriesAddQuantiles(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Quantiles = "p50,p99"
+	ts.Interval = time.Minute
+	start := time.Unix(1400000040, 0)
+	ts.Add(start, 1, nil)
+	ts.Add(start.Add(time.Second), 3, nil)
+	if len(ts.Series) != 0 {
+		t.Error("Add plotted quantiles before the interval was over")
+	}
+	ts.Add(start.Add(time.Minute), 5, nil)
+
+	if len(ts.Values) != 0 {
+		t.Error("Add recorded raw values when plotting quantiles")
+	}
+	p50 := ts.Series["p50"]
+	if p50 == nil || ts.Series["p99"] == nil {
+		t.Fatal("Add did not create a series for each quantile")
+	}
+	if len(p50.Values) != 1 {
+		t.Errorf("Add plotted the current interval (%v)", p50.Values)
+	}
+	_, indicator := ts.Changed(0)
+	ts.Expire(time.Now())
+	if changed, _ := ts.Changed(indicator); !changed || len(p50.Values) != 2 {
+		t.Errorf("Expire didn't plot the current interval (%v)", p50.Values)
+	}
+	first := start.Truncate(time.Minute).Format(time.RFC3339Nano)
+	if p50.Values[first] != 2 {
+		t.Errorf("Add recorded the wrong quantile (%v)", p50.Values[first])
+	}
+	if ts.Count != 3 {
+		t.Error("Add recorded the wrong count when plotting quantiles")
+	}
+
+	ts.Add(start.Add(2*time.Second), 100, nil)
+	if p50.Values[first] != 2 || ts.Filtered != 1 {
+		t.Errorf("Add didn't filter a value for an earlier interval (%v)", p50.Values[first])
+	}
+}
+
+func TestTimeSeriesAddOutOfOrder(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Window = 2
+	ts.Add(time.Unix(1400000002, 0), 2, nil)
+	ts.Add(time.Unix(1400000000, 0), 0, nil)
+	ts.Add(time.Unix(1400000001, 0), 1, nil)
+
+	if len(ts.Values) != 2 {
+		t.Error("Add recorded too many values for windowed")
+	}
+	if _, ok := ts.Values[time.Unix(1400000000, 0).Format(time.RFC3339Nano)]; ok {
+		t.Error("Add did not drop the oldest value for windowed")
+	}
+	if ts.Values[time.Unix(1400000001, 0).Format(time.RFC3339Nano)] != 1 {
+		t.Error("Add dropped an out of order value that was not the oldest")
+	}
+}
+
+func TestSeriesMinMax(t *testing.T) {
+	s := newSeries(make(map[string]Countable))
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		when := time.Unix(1400000000+int64(i), 0)
+		if i%3 == 0 {
+			// Replace the newest value now and then.
+			when = when.Add(-time.Second)
+		} else if i%7 == 0 {
+			// Replace or insert an older value now and then.
+			when = when.Add(-time.Duration(random.Intn(12)) * time.Second)
+		}
+		s.add(when, Countable(i%50+random.Intn(10)), i+1)
+		s.evict(i+1, 10, time.Time{})
+
+		min, max := Countable(math.Inf(1)), Countable(math.Inf(-1))
+		for _, val := range s.Values {
+			if val < min {
+				min = val
+			}
+			if val > max {
+				max = val
+			}
+		}
+		if s.Min != min || s.Max != max {
+			t.Fatalf("Min and Max were wrong after %v values (%v, %v rather than %v, %v)", i+1, s.Min, s.Max, min, max)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Unix(1400000000, 500000000)
+	formats := map[string]string{
+		"rfc3339":             "2014-05-13T16:53:20.5Z",
+		"unix":                "1400000000.5",
+		"unixms":              "1400000000500",
+		"2006-01-02 15:04:05": "2014-05-13 16:53:20.5",
+	}
+	for format, str := range formats {
+		when, err := ParseTime(str, format)
+		if err != nil || !when.Equal(expected) {
+			t.Errorf("ParseTime failed for %v (%v, %v)", format, when, err)
+		}
+	}
+
+	_, err := ParseTime("yesterday", "rfc3339")
+	if err == nil {
+		t.Error("ParseTime parsed an invalid time")
+	}
+}
+
+func TestTimeSeriesReadTimes(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.TimeColumn = 1
+	ts.TimeFormat = "unix"
+	reader := strings.NewReader("1400000001 2\n1400000000 1\nfoo 3\n1400000002\n")
+	ts.Read(reader)
+	if ts.Count != 2 || ts.Errors != 2 {
+		t.Error("Read failed to read timestamps from the input")
+	}
+	if ts.Values[time.Unix(1400000000, 0).Format(time.RFC3339Nano)] != 1 {
+		t.Error("Read failed to use the timestamp from the input")
+	}
+
+	ts = NewTimeSeries()
+	ts.TimeColumn = 2
+	ts.SeriesColumn = 3
+	ts.TimeFormat = "2006-01-02 15:04:05"
+	reader = strings.NewReader("5 2014-05-13 16:53:20 p50\n")
+	ts.Read(reader)
+	p50 := ts.Series["p50"]
+	if p50 == nil || p50.Values["2014-05-13T16:53:20Z"] != 5 {
+		t.Error("Read failed to read a timestamp spanning several fields")
+	}
+}
+
+func TestTimeSeriesAddMaxAge(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxAge = time.Minute
+	ts.Add(time.Unix(1400000000, 0), 10, nil)
+	ts.Add(time.Unix(1400000030, 0), 1, nil)
+	ts.Add(time.Unix(1400000070, 0), 2, nil)
+
+	if len(ts.Values) != 2 {
+		t.Error("Add did not drop values older than the max age")
+	}
+	if _, ok := ts.Values[time.Unix(1400000000, 0).Format(time.RFC3339Nano)]; ok {
+		t.Error("Add dropped the wrong value for max age")
+	}
+	if ts.Min != 1 || ts.Max != 2 {
+		t.Error("Add did not keep value stats consistent with retained values")
+	}
+}
+
+func TestTimeSeriesExpire(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxAge = time.Minute
+	now := time.Now()
+	ts.AddTo("a", now, 1, nil)
+	ts.AddTo("b", now.Add(time.Minute), 2, nil)
+	_, indicator := ts.Changed(0)
+
+	ts.Expire(now.Add(90 * time.Second))
+	if ts.Series["a"] != nil || len(ts.Series["b"].Values) != 1 {
+		t.Error("Expire did not drop values older than the max age")
+	}
+	changed, _ := ts.Changed(indicator)
+	if !changed {
+		t.Error("Changed did not report expired values as a change")
+	}
+	if ts.Min != 2 || ts.Max != 2 {
+		t.Error("Expire did not keep value stats consistent with retained values")
+	}
+
+	ts.TimeColumn = 1
+	ts.Expire(now.Add(time.Hour))
+	if len(ts.Series["b"].Values) != 1 {
+		t.Error("Expire dropped values with timestamps from the input")
+	}
+}
+
+func TestTimeSeriesExpireAll(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxAge = time.Minute
+	now := time.Now()
+	ts.Add(now, 1, nil)
+	_, indicator := ts.Changed(0)
+
+	ts.Expire(now.Add(time.Hour))
+	delta, err := json.Marshal(ts.Delta(indicator))
+	if err != nil {
+		t.Fatalf("Delta of an empty time series could not be marshaled (%v)", err)
+	}
+	if !strings.Contains(string(delta), `"Min":null,"Max":null`) {
+		t.Errorf("Delta included stats of no values (%s)", delta)
+	}
+	if !strings.Contains(string(delta), `"Removed":["`) {
+		t.Errorf("Delta didn't include the expired point (%s)", delta)
+	}
+}
+
+func TestTimeSeriesDeltaRollups(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Rollups = "1m"
+	ts.Width = 2
+	start := time.Unix(1400000040, 0)
+	ts.Add(start, 1, nil)
+	ts.Add(start.Add(time.Second), 3, nil)
+	_, indicator := ts.Changed(0)
+	ts.Delta(0)
+
+	// Going past the width switches to rollups, so the whole series is sent.
+	ts.Add(start.Add(2*time.Second), 5, nil)
+	if ts.Delta(indicator) != ts {
+		t.Fatal("Delta did not send the whole series at a new resolution")
+	}
+	full, err := json.Marshal(ts)
+	if err != nil {
+		t.Fatal("time series could not be marshaled")
+	}
+	key := start.Format(time.RFC3339Nano)
+	rollup := `"Rollups":{"` + key + `":{"Min":1,"Max":5,"Avg":3,"Count":3}}`
+	if !strings.Contains(string(full), `"Resolution":"1m0s"`) ||
+		!strings.Contains(string(full), rollup) {
+		t.Errorf("time series was not marshaled with rollups (%s)", full)
+	}
+
+	// Further changes at the same resolution are sent as rollups.
+	_, indicator = ts.Changed(indicator)
+	ts.Add(start.Add(3*time.Second), 7, nil)
+	delta, err := json.Marshal(ts.Delta(indicator))
+	if err != nil {
+		t.Fatal("Delta could not be marshaled")
+	}
+	rollup = `"Rollups":{"` + key + `":{"Min":1,"Max":7,"Avg":4,"Count":4}}`
+	if !strings.Contains(string(delta), rollup) ||
+		!strings.Contains(string(delta), `"Values":{}`) ||
+		!strings.Contains(string(delta), `"Partial":true`) {
+		t.Errorf("Delta did not include the changed rollups (%s)", delta)
+	}
+}
+
+func TestTimeSeriesMarshalEmptySeries(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.MaxAge = time.Minute
+	ts.Add(time.Unix(1400000000, 0), 1, nil)
+	ts.AddTo("a", time.Unix(1400000000, 0), 1, nil)
+	ts.AddTo("b", time.Unix(1400000070, 0), 1, nil)
+
+	marshaled, err := json.Marshal(ts)
+	if err != nil {
+		t.Fatalf("time series with an empty series could not be marshaled (%v)", err)
+	}
+	if !strings.Contains(string(marshaled), `"Values":{},"Series":{"b":`) {
+		t.Errorf("empty series was marshaled wrong (%s)", marshaled)
+	}
+	if _, ok := ts.Series["a"]; ok {
+		t.Error("Add didn't drop a named series left empty")
+	}
+}
+
+func TestTimeSeriesAddRate(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Rate = true
+	start := time.Unix(1400000000, 0)
+	ts.Add(start, 100, nil)
+	if len(ts.Values) != 0 {
+		t.Error("Add plotted the first value of a counter")
+	}
+
+	ts.Add(start.Add(2*time.Second), 110, nil)
+	if ts.Values[start.Add(2*time.Second).Format(time.RFC3339Nano)] != 5 {
+		t.Errorf("Add plotted the wrong rate (%v)", ts.Values)
+	}
+
+	// A decrease means the counter was reset.
+	ts.Add(start.Add(4*time.Second), 4, nil)
+	if ts.Values[start.Add(4*time.Second).Format(time.RFC3339Nano)] != 2 {
+		t.Errorf("Add plotted the wrong rate for a reset (%v)", ts.Values)
+	}
+
+	ts.Add(start.Add(3*time.Second), 50, nil)
+	if len(ts.Values) != 2 {
+		t.Error("Add plotted a rate for an out of order value")
+	}
+	if ts.Count != 4 {
+		t.Error("Add did not count the values it couldn't plot")
+	}
+}
+
+func TestTimeSeriesDeltaSmoothed(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Smoothing = "sma:2"
+	start := time.Unix(1400000000, 0)
+	ts.Add(start, 2, nil)
+	_, last := ts.Changed(0)
+	ts.Add(start.Add(time.Second), 4, nil)
+
+	delta, err := json.Marshal(ts.Delta(last))
+	if err != nil {
+		t.Fatalf("Delta couldn't be marshaled: %v", err)
+	}
+	key := start.Add(time.Second).Format(time.RFC3339Nano)
+	if !strings.Contains(string(delta), `"Smoothed":{"`+key+`":3}`) {
+		t.Errorf("Delta didn't include the smoothed values (%s)", delta)
+	}
+}
+
+func TestTimeSeriesReadField(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Delimiter = "comma"
+	ts.TimeColumn = 1
+	ts.TimeFormat = "unix"
+	ts.SeriesColumn = 2
+	ts.Field = "4"
+	ts.Read(strings.NewReader("1400000000,a,ignored,5\n1400000001,b,ignored,6\n"))
+
+	if ts.Count != 2 || ts.Errors != 0 {
+		t.Fatalf("Read didn't read the field (%v, %v)", ts.Count, ts.Errors)
+	}
+	key := time.Unix(1400000001, 0).Format(time.RFC3339Nano)
+	if ts.Series["b"].Values[key] != 6 {
+		t.Errorf("Read stored the wrong value (%v)", ts.Series["b"].Values)
+	}
+}
+
+func TestTimeSeriesReadFieldAfterTime(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.TimeColumn = 1
+	ts.TimeFormat = "2006-01-02 15:04:05"
+	ts.Field = "4"
+	ts.Read(strings.NewReader("2014-05-13 16:53:20 ignored 5\n"))
+
+	if ts.Count != 1 || ts.Values["2014-05-13T16:53:20Z"] != 5 {
+		t.Errorf("Read didn't count the fields of the time (%v)", ts.Values)
+	}
+}
+
+func TestTimeSeriesReadJSON(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Format = "json"
+	ts.Field = "latency_ms"
+	ts.TimeField = "meta.ts"
+	ts.TimeFormat = "unix"
+	ts.Read(strings.NewReader(`{"meta": {"ts": 1400000000}, "latency_ms": 12}
+{"meta": {"ts": "1400000001"}, "latency_ms": 15}
+{"latency_ms": 15}
+`))
+
+	if ts.Count != 2 || ts.Errors != 1 {
+		t.Fatalf("Read didn't read JSON (%v, %v)", ts.Count, ts.Errors)
+	}
+	key := time.Unix(1400000001, 0).Format(time.RFC3339Nano)
+	if ts.Values[key] != 15 {
+		t.Errorf("Read stored the wrong value (%v)", ts.Values)
+	}
+}
+
+func TestTimeSeriesReadCSV(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.Format = "csv"
+	ts.TimeField = "ts"
+	ts.TimeFormat = "unix"
+	ts.Read(strings.NewReader(`cpu,ts,"mem used"
+0.5,1400000000,100
+0.75,1400000001,
+0.25,1400000002
+`))
+
+	if ts.Count != 3 || ts.Errors != 1 {
+		t.Fatalf("Read didn't read CSV (%v, %v)", ts.Count, ts.Errors)
+	}
+	if len(ts.Series) != 2 || len(ts.Values) != 0 {
+		t.Fatalf("Read didn't add a series per column (%v)", ts.Series)
+	}
+	key := time.Unix(1400000001, 0).Format(time.RFC3339Nano)
+	if ts.Series["cpu"].Values[key] != 0.75 {
+		t.Errorf("Read stored the wrong value (%v)", ts.Series["cpu"].Values)
+	}
+	if len(ts.Series["mem used"].Values) != 1 {
+		t.Errorf("Read didn't skip an empty value (%v)", ts.Series["mem used"].Values)
+	}
+}
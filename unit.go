@@ -0,0 +1,84 @@
+package graphblast
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A unit is a measure of time, of bytes, or a plain multiple.
+type unit struct {
+	dimension string  // "time", "bytes", or "" for a plain multiple
+	scale     float64 // the size of the unit in seconds, bytes, or ones
+}
+
+// units are the suffixes understood by ParseUnit. Durations are written as
+// in Go, and the SI suffixes are only multiples, so "m" is a minute rather
+// than a thousandth.
+var units = map[string]unit{
+	"ns":  {"time", 1e-9},
+	"us":  {"time", 1e-6},
+	"µs":  {"time", 1e-6},
+	"μs":  {"time", 1e-6},
+	"ms":  {"time", 1e-3},
+	"s":   {"time", 1},
+	"m":   {"time", 60},
+	"h":   {"time", 3600},
+	"B":   {"bytes", 1},
+	"kB":  {"bytes", 1e3},
+	"KB":  {"bytes", 1e3},
+	"MB":  {"bytes", 1e6},
+	"GB":  {"bytes", 1e9},
+	"TB":  {"bytes", 1e12},
+	"PB":  {"bytes", 1e15},
+	"KiB": {"bytes", 1 << 10},
+	"MiB": {"bytes", 1 << 20},
+	"GiB": {"bytes", 1 << 30},
+	"TiB": {"bytes", 1 << 40},
+	"PiB": {"bytes", 1 << 50},
+	"k":   {"", 1e3},
+	"K":   {"", 1e3},
+	"M":   {"", 1e6},
+	"G":   {"", 1e9},
+	"T":   {"", 1e12},
+	"P":   {"", 1e15},
+}
+
+// splitUnit separates a number from the suffix following it, if any.
+func splitUnit(str string) (string, string) {
+	end := 0
+	for end < len(str) && strings.IndexByte("+-.0123456789eE", str[end]) >= 0 {
+		end += 1
+	}
+	return str[:end], strings.TrimSpace(str[end:])
+}
+
+// ParseUnit parses a value with an optional suffix (such as "12ms", "1.5s",
+// "1h30m", "3.4KiB" or "2k"), converting it to base, which may be one of the
+// units of time or bytes, or any other label, or "" for seconds or bytes.
+// Values without a suffix are taken to be in base already.
+func ParseUnit(str string, base string) (Countable, error) {
+	if d, err := strconv.ParseFloat(str, 64); err == nil {
+		return Countable(d), nil
+	}
+
+	number, suffix := splitUnit(strings.TrimSpace(str))
+	var val float64
+	u, ok := units[suffix]
+	if d, err := strconv.ParseFloat(number, 64); ok && err == nil {
+		val = d * u.scale
+	} else if d, err := time.ParseDuration(str); err == nil {
+		u = units["s"]
+		val = d.Seconds()
+	} else {
+		return 0, errors.New("invalid value: " + str)
+	}
+
+	if u.dimension == "" || base == "" {
+		return Countable(val), nil
+	} else if to, ok := units[base]; ok && to.dimension == u.dimension {
+		return Countable(val / to.scale), nil
+	}
+	return 0, errors.New("invalid unit for " + base + ": " + str)
+}
@@ -0,0 +1,65 @@
+package graphblast
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		str      string
+		base     string
+		expected Countable
+	}{
+		{"12", "", 12},
+		{"12", "ms", 12},
+		{"1.5s", "", 1.5},
+		{"1.5s", "ms", 1500},
+		{"12ms", "s", 0.012},
+		{"-250us", "ms", -0.25},
+		{"1h30m", "m", 90},
+		{"3.5KiB", "", 3584},
+		{"3.5 KiB", "B", 3584},
+		{"2MB", "kB", 2000},
+		{"2k", "", 2000},
+		{"2k", "ms", 2000},
+		{"1e3ms", "", 1},
+	}
+	for _, test := range tests {
+		val, err := ParseUnit(test.str, test.base)
+		if err != nil || val != test.expected {
+			t.Errorf("ParseUnit(%q, %q) returned %v (%v)",
+				test.str, test.base, val, err)
+		}
+	}
+}
+
+func TestParseUnitError(t *testing.T) {
+	tests := []struct {
+		str  string
+		base string
+	}{
+		{"a", ""},
+		{"ms", ""},
+		{"12 parsecs", ""},
+		{"12ms", "B"},
+		{"3KiB", "req/s"},
+	}
+	for _, test := range tests {
+		if _, err := ParseUnit(test.str, test.base); err == nil {
+			t.Errorf("ParseUnit(%q, %q) didn't fail", test.str, test.base)
+		}
+	}
+}
+
+func TestHistogramReadUnit(t *testing.T) {
+	hist := NewHistogram()
+	hist.Unit = "ms"
+	hist.Read(strings.NewReader("12ms\n0.5s\n7\n1KiB\n"))
+	if hist.Count != 3 || hist.Errors != 1 {
+		t.Errorf("Read didn't parse units (%v, %v)", hist.Count, hist.Errors)
+	}
+	if hist.Min != 7 || hist.Max != 500 {
+		t.Errorf("Read converted values wrongly (%v, %v)", hist.Min, hist.Max)
+	}
+}
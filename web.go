@@ -61,7 +61,8 @@ func ExtractNamed(text string, pattern *regexp.Regexp) map[string]string {
 // ParseGraphURL returns a graph name and a graph object built from the
 // path and query parameters of the URL. A regular expression is used to
 // extract the graph name and type, and is expected to have two named capture
-// groups: "name" for the graph name and "type" for the graph type.
+// groups: "name" for the graph name and "type" for the graph type. No graph is
+// returned if the parameters are invalid.
 func ParseGraphURL(url *url.URL, pattern *regexp.Regexp) (string, Graph) {
 	parts := ExtractNamed(url.Path, pattern)
 	graphType, ok := parts["type"]
@@ -78,6 +79,10 @@ func ParseGraphURL(url *url.URL, pattern *regexp.Regexp) (string, Graph) {
 	if !boundOk {
 		return "", nil
 	}
+	if err := Validate(graph); err != nil {
+		Log("rejecting graph parameters: %v", err)
+		return "", nil
+	}
 
 	graphName, ok := parts["name"]
 	if !ok {
@@ -128,7 +133,7 @@ func Events(requests chan<- GraphRequest, publisher Publisher) http.HandlerFunc
 				contents, msgErr := msg.Contents()
 				Log("Sending: %s %s", envelope, string(contents))
 				if msgErr != nil {
-					// TODO Log it
+					Log("couldn't marshal %s: %v", envelope, msgErr)
 					continue
 				}
 				io.WriteString(w, fmt.Sprintf("event: %s\n", envelope))